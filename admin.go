@@ -0,0 +1,129 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var adminTemplate = template.Must(template.New("admin").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Books admin</title>
+</head>
+<body>
+<h1>Books</h1>
+{{if .Message}}<p><strong>{{.Message}}</strong></p>{{end}}
+<form method="post" action="/admin/books">
+<input name="bookname" placeholder="Title" required>
+<input name="author" placeholder="Author" required>
+<input name="genre" placeholder="Genre">
+<input name="publisher" placeholder="Publisher">
+<select name="status">
+<option value="draft">draft</option>
+<option value="published">published</option>
+</select>
+<button type="submit">Add book</button>
+</form>
+<table>
+<tr><th>ID</th><th>Title</th><th>Author</th><th>Genre</th><th>Publisher</th><th>Status</th><th></th></tr>
+{{range .Books}}<tr>
+<td>{{.BookID}}</td><td>{{.BookName}}</td><td>{{.Author}}</td><td>{{.Genre}}</td><td>{{.Publisher}}</td><td>{{.Status}}</td>
+<td><form method="post" action="/admin/books/delete"><input type="hidden" name="bookid" value="{{.BookID}}"><button type="submit">Delete</button></form></td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type adminPage struct {
+	Message string
+	Books   []Book
+}
+
+func renderAdmin(w http.ResponseWriter, status int, message string) {
+	books, err := getBookList(bookFilter{})
+	if err != nil {
+		log.Print(err)
+		status = http.StatusInternalServerError
+		message = "could not list books"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := adminTemplate.Execute(w, adminPage{Message: message, Books: books}); err != nil {
+		log.Print(err)
+	}
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func handleAdmin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		renderAdmin(w, http.StatusOK, "")
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleAdminAddBook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin form submission", http.StatusForbidden)
+		return
+	}
+	book := Book{
+		BookName:  r.PostFormValue("bookname"),
+		Author:    r.PostFormValue("author"),
+		Genre:     r.PostFormValue("genre"),
+		Publisher: r.PostFormValue("publisher"),
+		Status:    r.PostFormValue("status"),
+	}
+	applyBookDefaults(&book)
+	if errs := validateBook(book); len(errs) > 0 {
+		renderAdmin(w, validationStatus(), strings.Join(errs, "; "))
+		return
+	}
+	if _, err := insertBook(book, requestActor(r)); err != nil {
+		log.Print(err)
+		renderAdmin(w, http.StatusInternalServerError, "could not create book")
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func handleAdminDeleteBook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin form submission", http.StatusForbidden)
+		return
+	}
+	bookID, err := strconv.Atoi(r.PostFormValue("bookid"))
+	if err != nil {
+		renderAdmin(w, http.StatusBadRequest, "invalid bookid")
+		return
+	}
+	if err := removeBook(bookID, requestActor(r)); err != nil {
+		log.Print(err)
+		renderAdmin(w, http.StatusInternalServerError, "could not delete book")
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
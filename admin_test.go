@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const adminAuth = "Basic YWRtaW46c2VjcmV0"
+
+func useAdminCredentials(t *testing.T) {
+	setForTest(t, &apiUsername, "admin")
+	setForTest(t, &apiPassword, "secret")
+}
+
+func TestAdminPageListsBooks(t *testing.T) {
+	useAdminCredentials(t)
+	draft := testBook(2, "<Draft>")
+	draft.Status = statusDraft
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(testBook(1, "Dune"), draft)
+	})
+	w := serve(requireAuth(handleAdmin), http.MethodGet, "/admin", "", map[string]string{"Authorization": adminAuth})
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, want := range []string{"<td>1</td><td>Dune</td><td>Alan Donovan</td>", "<td>&lt;Draft&gt;</td>", `name="bookid" value="2"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page is missing %q", want)
+		}
+	}
+}
+
+func TestAdminPageRequiresAuth(t *testing.T) {
+	useAdminCredentials(t)
+	w := serve(requireAuth(handleAdmin), http.MethodGet, "/admin", "", nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestAdminAddBookRedirects(t *testing.T) {
+	useAdminCredentials(t)
+	store := &insertStore{nextID: 4}
+	useFakeDB(t, store.handle)
+	w := serve(requireAuth(handleAdminAddBook), http.MethodPost, "/admin/books", "bookname=Emma&author=Jane+Austen&status=published",
+		map[string]string{"Authorization": adminAuth, "Content-Type": "application/x-www-form-urlencoded"})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/admin" {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if len(store.books) != 1 || store.books[0].BookName != "Emma" || store.books[0].Status != statusPublished {
+		t.Errorf("stored = %+v", store.books)
+	}
+}
+
+func TestAdminRejectsCrossOriginForm(t *testing.T) {
+	useAdminCredentials(t)
+	fake := useFakeDB(t, nil)
+	w := serve(requireAuth(handleAdminDeleteBook), http.MethodPost, "/admin/books/delete", "bookid=1",
+		map[string]string{"Authorization": adminAuth, "Content-Type": "application/x-www-form-urlencoded", "Origin": "https://evil.example"})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
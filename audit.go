@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	auditInsert = "insert"
+	auditUpdate = "update"
+	auditDelete = "delete"
+)
+
+var (
+	auditLogFile = getEnv("AUDIT_LOG_FILE", "")
+	auditSink    *log.Logger
+
+	auditPendingMu sync.Mutex
+	auditPending   = make(map[*sql.Tx][]string)
+)
+
+func setAuditSink(w io.Writer) {
+	auditSink = log.New(w, "", log.LstdFlags|log.LUTC)
+}
+
+func openAuditSink(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	setAuditSink(file)
+	return nil
+}
+
+type auditEntry struct {
+	ID        int64           `json:"id"`
+	BookID    int             `json:"bookid"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	OldValue  json.RawMessage `json:"old_value"`
+	NewValue  json.RawMessage `json:"new_value"`
+	CreatedAt Timestamp       `json:"created_at"`
+}
+
+func requestActor(r *http.Request) string {
+	if user, ok := userFromContext(r.Context()); ok {
+		return user
+	}
+	return clientIP(r)
+}
+
+func getBookTx(ctx context.Context, tx *sql.Tx, bookID int) (*Book, error) {
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE bookid = ? AND deleted_at IS NULL FOR UPDATE`, bookColumns, booksTable)
+	logQuery(query, []interface{}{bookID})
+	book := &Book{}
+	err := scanBook(recordedRow{tx.QueryRowContext(ctx, query, bookID)}, book)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+func auditJSON(book *Book) (interface{}, error) {
+	if book == nil {
+		return nil, nil
+	}
+	j, err := json.Marshal((*canonicalBook)(book))
+	if err != nil {
+		return nil, err
+	}
+	return string(j), nil
+}
+
+type auditRow struct {
+	bookID  int
+	oldBook *Book
+	newBook *Book
+}
+
+func insertAuditTx(ctx context.Context, tx *sql.Tx, bookID int, action, actor string, oldBook, newBook *Book) error {
+	return insertAuditRowsTx(ctx, tx, action, actor, []auditRow{{bookID: bookID, oldBook: oldBook, newBook: newBook}})
+}
+
+func insertAuditRowsTx(ctx context.Context, tx *sql.Tx, action, actor string, rows []auditRow) error {
+	values := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, 5*len(rows))
+	for _, row := range rows {
+		oldValue, err := auditJSON(row.oldBook)
+		if err != nil {
+			return err
+		}
+		newValue, err := auditJSON(row.newBook)
+		if err != nil {
+			return err
+		}
+		values = append(values, "(?, ?, ?, ?, ?)")
+		args = append(args, row.bookID, action, actor, oldValue, newValue)
+	}
+	_, err := txExecContext(ctx, tx, fmt.Sprintf(`INSERT INTO %s_audit (bookid, action, actor, old_value, new_value) VALUES `, booksTable)+strings.Join(values, ", "), args...)
+	if err == nil && auditSink != nil {
+		auditPendingMu.Lock()
+		for _, row := range rows {
+			auditPending[tx] = append(auditPending[tx], fmt.Sprintf("actor=%q action=%s bookid=%d", actor, action, row.bookID))
+		}
+		auditPendingMu.Unlock()
+	}
+	return err
+}
+
+func takeAuditRecords(tx *sql.Tx) []string {
+	auditPendingMu.Lock()
+	defer auditPendingMu.Unlock()
+	records := auditPending[tx]
+	delete(auditPending, tx)
+	return records
+}
+
+func commitTx(tx *sql.Tx) error {
+	err := tx.Commit()
+	records := takeAuditRecords(tx)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		auditSink.Print(record)
+	}
+	return nil
+}
+
+func rollbackTx(tx *sql.Tx) {
+	tx.Rollback()
+	takeAuditRecords(tx)
+}
+
+func auditedExecTx(ctx context.Context, tx *sql.Tx, actor, action string, bookID int, query string, args ...interface{}) (int, error) {
+	var oldBook *Book
+	if action != auditInsert {
+		var err error
+		oldBook, err = getBookTx(ctx, tx, bookID)
+		if err != nil || oldBook == nil {
+			return 0, err
+		}
+	}
+	result, err := txExecContext(ctx, tx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if action == auditInsert {
+		insertID, err := result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		bookID = int(insertID)
+	}
+	var newBook *Book
+	if action != auditDelete {
+		newBook, err = getBookTx(ctx, tx, bookID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return bookID, insertAuditTx(ctx, tx, bookID, action, actor, oldBook, newBook)
+}
+
+func auditedExec(actor, action string, bookID int, query string, args ...interface{}) (int, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return 0, err
+	}
+	defer cancel()
+	var id int
+	err = retryWrites(ctx, func() error {
+		tx, err := beginTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer rollbackTx(tx)
+		id, err = auditedExecTx(ctx, tx, actor, action, bookID, query, args...)
+		if err != nil {
+			return err
+		}
+		return commitTx(tx)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	if id != 0 {
+		publishBookChange(action, id)
+	}
+	return id, nil
+}
+
+func getBooksTx(ctx context.Context, tx *sql.Tx, where string, args ...interface{}) ([]Book, error) {
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s AND deleted_at IS NULL FOR UPDATE`, bookColumns, booksTable, where)
+	logQuery(query, args)
+	results, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	books := make([]Book, 0)
+	for results.Next() {
+		var book Book
+		if err := scanBook(results, &book); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, results.Err()
+}
+
+func auditedBulkUpdate(actor, set string, setArgs []interface{}, where string, whereArgs []interface{}) (int, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return 0, err
+	}
+	defer cancel()
+	var ids []int
+	err = retryWrites(ctx, func() error {
+		ids = nil
+		tx, err := beginTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer rollbackTx(tx)
+		oldBooks, err := getBooksTx(ctx, tx, where, whereArgs...)
+		if err != nil || len(oldBooks) == 0 {
+			return err
+		}
+		query := fmt.Sprintf(`UPDATE %s SET %s WHERE %s AND deleted_at IS NULL`, booksTable, set, where)
+		if _, err := txExecContext(ctx, tx, query, append(append([]interface{}{}, setArgs...), whereArgs...)...); err != nil {
+			return err
+		}
+		for i := range oldBooks {
+			newBook, err := getBookTx(ctx, tx, oldBooks[i].BookID)
+			if err != nil {
+				return err
+			}
+			if err := insertAuditTx(ctx, tx, oldBooks[i].BookID, auditUpdate, actor, &oldBooks[i], newBook); err != nil {
+				return err
+			}
+			ids = append(ids, oldBooks[i].BookID)
+		}
+		return commitTx(tx)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	for _, id := range ids {
+		publishBookChange(auditUpdate, id)
+	}
+	return len(ids), nil
+}
+
+func getBookHistory(bookID int) ([]auditEntry, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	results, err := readQueryContext(ctx, fmt.Sprintf(`SELECT id, bookid, action, actor, old_value, new_value, created_at FROM %s_audit WHERE bookid = ? ORDER BY id`, booksTable), bookID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	entries := make([]auditEntry, 0)
+	for results.Next() {
+		var entry auditEntry
+		var oldValue, newValue []byte
+		err := results.Scan(&entry.ID, &entry.BookID, &entry.Action, &entry.Actor, &oldValue, &newValue, &entry.CreatedAt)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+		if oldValue != nil {
+			entry.OldValue = oldValue
+		}
+		if newValue != nil {
+			entry.NewValue = newValue
+		}
+		entries = append(entries, entry)
+	}
+	if err := results.Err(); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return entries, nil
+}
+
+func handleBookHistory(w http.ResponseWriter, r *http.Request, bookID int) {
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := getBookHistory(bookID)
+		if err != nil {
+			writeDBError(w, r, err, "could not get book history")
+			return
+		}
+		for i := range entries {
+			if entries[i].OldValue, err = visibleAuditValue(r, entries[i].OldValue); err == nil {
+				entries[i].NewValue, err = visibleAuditValue(r, entries[i].NewValue)
+			}
+			if err != nil {
+				writeErrorDetail(w, r, http.StatusInternalServerError, "could not get book history", err)
+				return
+			}
+		}
+		writeJSON(w, r, http.StatusOK, entries)
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
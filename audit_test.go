@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// statusStore is a bookStore whose status UPDATE really changes the book, so
+// audit rows can be checked for distinct old and new values.
+func statusStore(books map[int]Book) func(string, []driver.Value) fakeResult {
+	store := bookStore(books, 0)
+	return func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "UPDATE books SET status = ?") {
+			book := books[int(args[1].(int64))]
+			book.Status = args[0].(string)
+			books[book.BookID] = book
+			return fakeResult{affected: 1}
+		}
+		return store(query, args)
+	}
+}
+
+func TestUpdateWritesAuditRowInTransaction(t *testing.T) {
+	draft := testBook(1, "Dune")
+	draft.Status = statusDraft
+	fake := useFakeDB(t, statusStore(map[int]Book{1: draft}))
+	if err := setBookStatus(1, statusPublished, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	audit, ok := fake.find("INSERT INTO books_audit")
+	if !ok {
+		t.Fatalf("no audit row in %v", fake.queries())
+	}
+	if audit.args[0] != int64(1) || audit.args[1] != auditUpdate || audit.args[2] != "alice" {
+		t.Errorf("audit args = %v", audit.args[:3])
+	}
+	var oldValue, newValue Book
+	if err := json.Unmarshal([]byte(audit.args[3].(string)), &oldValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(audit.args[4].(string)), &newValue); err != nil {
+		t.Fatal(err)
+	}
+	if oldValue.Status != statusDraft || newValue.Status != statusPublished {
+		t.Errorf("old = %s, new = %s", oldValue.Status, newValue.Status)
+	}
+	queries := fake.queries()
+	if !strings.HasSuffix(queries[0], "FOR UPDATE") || queries[len(queries)-1] != audit.query {
+		t.Errorf("queries = %v", queries)
+	}
+	if fake.commits != 1 {
+		t.Errorf("commits = %d, want the change and audit row in one transaction", fake.commits)
+	}
+}
+
+func TestDeleteAuditRowHasNoNewValue(t *testing.T) {
+	fake := useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	if err := removeBook(1, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	audit, ok := fake.find("INSERT INTO books_audit")
+	if !ok || audit.args[1] != auditDelete || audit.args[3] == nil || audit.args[4] != nil {
+		t.Fatalf("audit = %+v", audit)
+	}
+}
+
+func TestBookHistory(t *testing.T) {
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{
+			columns: []string{"id", "bookid", "action", "actor", "old_value", "new_value", "created_at"},
+			rows: [][]driver.Value{
+				{int64(1), int64(1), auditInsert, "alice", nil, []byte(`{"bookname":"Dune","stock":1}`), testTime},
+				{int64(2), int64(1), auditUpdate, "bob", []byte(`{"bookname":"Dune","stock":1}`), []byte(`{"bookname":"Dune","stock":2}`), testTime},
+			},
+		}
+	})
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1/history", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var entries []auditEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != auditInsert || string(entries[0].OldValue) != "null" || entries[1].Actor != "bob" {
+		t.Fatalf("entries = %s", w.Body.String())
+	}
+	if history, _ := fake.find("FROM books_audit"); !strings.HasSuffix(history.query, "ORDER BY id") || history.args[0] != int64(1) {
+		t.Errorf("history query = %+v", history)
+	}
+}
+
+func TestBookHistoryHidesPrivateFields(t *testing.T) {
+	setForTest(t, &publicFields, []string{"bookname"})
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{
+			columns: []string{"id", "bookid", "action", "actor", "old_value", "new_value", "created_at"},
+			rows:    [][]driver.Value{{int64(1), int64(1), auditInsert, "alice", nil, []byte(`{"bookname":"Dune","stock":1}`), testTime}},
+		}
+	})
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1/history", "", nil)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "stock") || !strings.Contains(w.Body.String(), `"new_value":{"bookname":"Dune"}`) {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func useAuditSink(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	setForTest(t, &auditSink, nil)
+	setAuditSink(&buf)
+	return &buf
+}
+
+func TestAuditSinkGetsRecordsNotMainLog(t *testing.T) {
+	sink := useAuditSink(t)
+	logs := captureLog(t)
+	draft := testBook(1, "Dune")
+	draft.Status = statusDraft
+	useFakeDB(t, statusStore(map[int]Book{1: draft}))
+	if err := setBookStatus(1, statusPublished, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sink.String(), `actor="alice" action=update bookid=1`) || strings.Count(sink.String(), "\n") != 1 {
+		t.Errorf("sink = %q", sink.String())
+	}
+	if strings.Contains(logs.String(), "actor=") {
+		t.Errorf("audit record leaked into the application log: %q", logs.String())
+	}
+}
+
+func TestAuditSinkSkipsRolledBackWrites(t *testing.T) {
+	sink := useAuditSink(t)
+	books := []Book{testBook(1, "Dune"), testBook(2, "Emma")}
+	audits := 0
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.Contains(query, "WHERE genre = ?"):
+			return bookRows(books...)
+		case strings.Contains(query, "WHERE bookid = ?"):
+			return bookRows(books[args[0].(int64)-1])
+		case strings.HasPrefix(query, "INSERT INTO books_audit"):
+			if audits++; audits == 2 {
+				return fakeResult{err: errors.New("disk full")}
+			}
+		}
+		return fakeResult{affected: 2}
+	})
+	if _, err := recategorizeBooks("Programming", "Computing", "alice"); err == nil {
+		t.Fatal("expected the second audit insert to fail")
+	}
+	if fake.commits != 0 || fake.rollbacks != 1 {
+		t.Errorf("commits = %d, rollbacks = %d", fake.commits, fake.rollbacks)
+	}
+	if sink.Len() != 0 {
+		t.Errorf("rolled-back write reached the sink: %q", sink.String())
+	}
+	if len(auditPending) != 0 {
+		t.Errorf("pending records were not dropped: %v", auditPending)
+	}
+}
+
+func TestAuditTableFollowsBooksTable(t *testing.T) {
+	setForTest(t, &booksTable, "tenant_books")
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult { return fakeResult{} })
+	getBookHistory(1)
+	getBookChanges(0, 10)
+	if queries := fake.queries(); len(queries) != 2 || !strings.Contains(queries[0], "FROM tenant_books_audit ") || !strings.Contains(queries[1], "FROM tenant_books_audit ") {
+		t.Errorf("queries = %v", queries)
+	}
+	if statement := migrationSQL(migrations[8]); !strings.Contains(statement, "CREATE TABLE IF NOT EXISTS tenant_books_audit (") {
+		t.Errorf("migration = %q", statement)
+	}
+}
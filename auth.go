@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+var (
+	apiUsername = getEnv("API_USERNAME", "")
+	apiPassword = getEnv("API_PASSWORD", "")
+)
+
+func authenticate(r *http.Request) (string, bool) {
+	if apiUsername == "" || apiPassword == "" {
+		return "", false
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	usernameMatch := subtle.ConstantTimeCompare([]byte(username), []byte(apiUsername)) == 1
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(apiPassword)) == 1
+	return username, usernameMatch && passwordMatch
+}
+
+func userFromContext(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(userContextKey).(string)
+	return user, ok
+}
+
+func requireAuth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isPreflight(r) {
+			handler(w, r)
+			return
+		}
+		user, ok := authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="books"`)
+			writeError(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	}
+}
+
+var publicFieldsSetting = getEnv("PUBLIC_FIELDS", "")
+
+var publicFields []string
+
+func isAuthenticated(r *http.Request) bool {
+	_, ok := userFromContext(r.Context())
+	return ok
+}
+
+// authorizeStatus keeps drafts private: status=all and status=draft need an
+// authenticated caller.
+func authorizeStatus(w http.ResponseWriter, r *http.Request) bool {
+	status := r.URL.Query().Get("status")
+	if (status == "all" || status == statusDraft) && !isAuthenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="books"`)
+		writeError(w, r, http.StatusUnauthorized, "authentication required for status="+status)
+		return false
+	}
+	return true
+}
+
+func visibleFields(r *http.Request, requested []string) []string {
+	if len(publicFields) == 0 || isAuthenticated(r) {
+		return requested
+	}
+	var fields []string
+	for _, field := range requested {
+		for _, public := range publicFields {
+			if field == public {
+				fields = append(fields, field)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return publicFields
+	}
+	return fields
+}
+
+func visibleBooks(r *http.Request, books []Book) interface{} {
+	fields := visibleFields(r, nil)
+	if len(fields) == 0 {
+		return books
+	}
+	return projectBooks(books, fields)
+}
+
+func visibleBook(r *http.Request, book *Book) interface{} {
+	fields := visibleFields(r, nil)
+	if len(fields) == 0 {
+		return book
+	}
+	return projectBooks([]Book{*book}, fields)[0]
+}
+
+func visibleAuditValue(r *http.Request, value json.RawMessage) (json.RawMessage, error) {
+	fields := visibleFields(r, nil)
+	if len(fields) == 0 || len(value) == 0 {
+		return value, nil
+	}
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(value, &document); err != nil {
+		return nil, err
+	}
+	visible := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if v, ok := document[field]; ok {
+			visible[field] = v
+		}
+	}
+	return json.Marshal(visible)
+}
+
+func optionalAuthMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		user, ok := authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="books"`)
+			writeError(w, r, http.StatusUnauthorized, "invalid credentials")
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func responseKeys(t *testing.T, body []byte) string {
+	t.Helper()
+	var document map[string]interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		var list []map[string]interface{}
+		if err := json.Unmarshal(body, &list); err != nil || len(list) == 0 {
+			t.Fatalf("body = %s", body)
+		}
+		document = list[0]
+	}
+	keys := make([]string, 0, len(document))
+	for key := range document {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func TestAnonymousCallersSeePublicFields(t *testing.T) {
+	useAdminCredentials(t)
+	setForTest(t, &publicFields, []string{"bookname", "author"})
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	handler := optionalAuthMiddleware(http.HandlerFunc(handleBook))
+
+	anonymous := serve(handler, http.MethodGet, "/api/books/1", "", nil)
+	if got := responseKeys(t, anonymous.Body.Bytes()); got != "author,bookname" {
+		t.Errorf("anonymous keys = %s", got)
+	}
+	authenticated := serve(handler, http.MethodGet, "/api/books/1", "", map[string]string{"Authorization": adminAuth})
+	if got := responseKeys(t, authenticated.Body.Bytes()); !strings.Contains(got, "stock") || !strings.Contains(got, "isbn") {
+		t.Errorf("authenticated keys = %s", got)
+	}
+}
+
+func TestAnonymousFieldsSelectionIsFiltered(t *testing.T) {
+	setForTest(t, &publicFields, []string{"bookname", "author"})
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return selectedRows(query, testBook(1, "Dune"))
+	})
+	w := serve(optionalAuthMiddleware(http.HandlerFunc(handleBooks)), http.MethodGet, "/api/books?fields=bookname,stock", "", nil)
+	if got := responseKeys(t, w.Body.Bytes()); got != "bookname" {
+		t.Errorf("keys = %s", got)
+	}
+	if list, _ := fake.find("SELECT"); strings.Contains(list.query, "stock") {
+		t.Errorf("query = %q, want restricted columns left out", list.query)
+	}
+}
+
+func TestBadCredentialsAreRejected(t *testing.T) {
+	useAdminCredentials(t)
+	w := serve(optionalAuthMiddleware(http.HandlerFunc(handleBook)), http.MethodGet, "/api/books/1", "", map[string]string{"Authorization": "Basic YWRtaW46d3Jvbmc="})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestAnonymousCallersCannotReadDrafts(t *testing.T) {
+	useAdminCredentials(t)
+	draft := testBook(1, "Dune")
+	draft.Status = statusDraft
+	draft.ISBN = "9780134190440"
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.Contains(query, "status = ?") {
+			return bookRows()
+		}
+		return bookRows(draft)
+	})
+	handler := routesMux()
+	for _, c := range []struct {
+		method, target, body string
+		hidden               int
+	}{
+		{http.MethodGet, "/api/books/1", "", http.StatusNotFound},
+		{http.MethodGet, "/api/books/isbn/978-0-13-419044-0", "", http.StatusNotFound},
+		{http.MethodPost, "/api/books/batch-get", `{"ids":[1]}`, http.StatusOK},
+	} {
+		anonymous := serve(handler, c.method, c.target, c.body, nil)
+		if anonymous.Code != c.hidden || strings.Contains(anonymous.Body.String(), "Dune") {
+			t.Errorf("anonymous %s: got %d %s", c.target, anonymous.Code, anonymous.Body.String())
+		}
+		authenticated := serve(handler, c.method, c.target, c.body, map[string]string{"Authorization": adminAuth})
+		if authenticated.Code != http.StatusOK || !strings.Contains(authenticated.Body.String(), `"status":"draft"`) {
+			t.Errorf("authenticated %s: got %d %s", c.target, authenticated.Code, authenticated.Body.String())
+		}
+	}
+	for _, status := range []string{"all", statusDraft} {
+		w := serve(handler, http.MethodGet, "/api/books?status="+status, "", nil)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("anonymous status=%s: got %d", status, w.Code)
+		}
+	}
+}
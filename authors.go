@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type AuthorCount struct {
+	Author string `json:"author"`
+	Count  int    `json:"count"`
+}
+
+func countByAuthor(limit int) ([]AuthorCount, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	query := fmt.Sprintf(`SELECT author, COUNT(*) AS books FROM %s WHERE deleted_at IS NULL AND status = ? GROUP BY author ORDER BY books DESC, author`, booksTable)
+	args := []interface{}{statusPublished}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	results, err := readQueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	counts := make([]AuthorCount, 0)
+	for results.Next() {
+		var count AuthorCount
+		if err := results.Scan(&count.Author, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, results.Err()
+}
+
+func handleCountByAuthor(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limit := 0
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 0 {
+				writeError(w, r, http.StatusBadRequest, "limit must be a non-negative integer")
+				return
+			}
+		}
+		counts, err := countByAuthor(limit)
+		if err != nil {
+			writeDBError(w, r, err, "could not count books by author")
+			return
+		}
+		writeJSONWithETag(w, r, counts)
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
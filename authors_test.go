@@ -0,0 +1,71 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// authorCountDB groups the given authors the way the COUNT(*) query does.
+func authorCountDB(t *testing.T, authors ...string) *fakeDB {
+	return useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		counts := map[string]int64{}
+		for _, author := range authors {
+			counts[author]++
+		}
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if counts[names[i]] != counts[names[j]] {
+				return counts[names[i]] > counts[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		if strings.HasSuffix(query, " LIMIT ?") {
+			if limit := int(args[1].(int64)); len(names) > limit {
+				names = names[:limit]
+			}
+		}
+		result := fakeResult{columns: []string{"author", "books"}}
+		for _, name := range names {
+			result.rows = append(result.rows, []driver.Value{name, counts[name]})
+		}
+		return result
+	})
+}
+
+func TestCountByAuthorGroupsAndOrders(t *testing.T) {
+	fake := authorCountDB(t, "Herbert", "Asimov", "Austen", "Asimov", "Herbert", "Asimov")
+	counts, err := countByAuthor(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AuthorCount{{"Asimov", 3}, {"Herbert", 2}, {"Austen", 1}}
+	if len(counts) != len(want) {
+		t.Fatalf("counts = %+v", counts)
+	}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Errorf("counts[%d] = %+v, want %+v", i, counts[i], want[i])
+		}
+	}
+	if query, _ := fake.find("GROUP BY author"); !strings.Contains(query.query, "ORDER BY books DESC, author") {
+		t.Errorf("query = %q", query.query)
+	}
+}
+
+func TestCountByAuthorLimit(t *testing.T) {
+	authorCountDB(t, "Herbert", "Asimov", "Austen", "Asimov")
+	w := serve(http.HandlerFunc(handleCountByAuthor), http.MethodGet, "/api/books/count-by-author?limit=2", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != `[{"author":"Asimov","count":2},{"author":"Austen","count":1}]`+"\n" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	w = serve(http.HandlerFunc(handleCountByAuthor), http.MethodGet, "/api/books/count-by-author?limit=-1", "", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("negative limit: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const maxBatchIDs = 1000
+
+type batchGetRequest struct {
+	IDs []int `json:"ids"`
+}
+
+func getBooksByIDs(ids []int, drafts bool) ([]Book, error) {
+	books := make([]Book, 0, len(ids))
+	if len(ids) == 0 {
+		return books, nil
+	}
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	where := fmt.Sprintf("bookid IN (%s) AND deleted_at IS NULL", placeholders)
+	if !drafts {
+		where += " AND status = ?"
+		args = append(args, statusPublished)
+	}
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY bookid`, bookColumns, booksTable, where)
+	results, err := readQueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	for results.Next() {
+		var book Book
+		if err := scanBook(results, &book); err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	if err := results.Err(); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return books, nil
+}
+
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func handleBatchGetBooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var request batchGetRequest
+		err := decodeJSON(r.Body, &request)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid batch-get payload: "+err.Error())
+			return
+		}
+		ids := uniqueIDs(request.IDs)
+		for _, id := range ids {
+			if !bookIDInRange(id) {
+				writeError(w, r, http.StatusBadRequest, fmt.Sprintf("id %d out of range, must be between 1 and %d", id, maxBookID))
+				return
+			}
+		}
+		if len(ids) > maxBatchIDs {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("at most %d ids may be requested", maxBatchIDs))
+			return
+		}
+		books, err := getBooksByIDs(ids, isAuthenticated(r))
+		if err != nil {
+			writeDBError(w, r, err, "could not get books")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, visibleBooks(r, books))
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// evenBooksDB stores a book for every even id.
+func evenBooksDB(t *testing.T) *fakeDB {
+	return useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		var books []Book
+		for _, arg := range args {
+			if id, ok := arg.(int64); ok && id%2 == 0 {
+				books = append(books, testBook(int(id), fmt.Sprintf("Book %d", id)))
+			}
+		}
+		return bookRows(books...)
+	})
+}
+
+func batchGet(t *testing.T, ids []int) ([]Book, int) {
+	t.Helper()
+	body, _ := json.Marshal(batchGetRequest{IDs: ids})
+	w := serve(http.HandlerFunc(handleBatchGetBooks), http.MethodPost, "/api/books/batch-get", string(body), nil)
+	var books []Book
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return books, w.Code
+}
+
+func TestBatchGetLargeIDList(t *testing.T) {
+	fake := evenBooksDB(t)
+	ids := make([]int, 0, maxBatchIDs)
+	for id := 1; id <= maxBatchIDs; id++ {
+		ids = append(ids, id)
+	}
+	books, status := batchGet(t, ids)
+	if status != http.StatusOK || len(books) != maxBatchIDs/2 {
+		t.Fatalf("got %d with %d books", status, len(books))
+	}
+	if queries := fake.queries(); len(queries) != 1 || strings.Count(queries[0], "?") != maxBatchIDs+1 {
+		t.Errorf("want a single IN query with %d placeholders", maxBatchIDs)
+	}
+}
+
+func TestBatchGetSomeMissing(t *testing.T) {
+	evenBooksDB(t)
+	books, status := batchGet(t, []int{1, 2, 3, 4, 4})
+	if status != http.StatusOK || len(books) != 2 || books[0].BookID != 2 || books[1].BookID != 4 {
+		t.Fatalf("got %d %+v", status, books)
+	}
+}
+
+func TestBatchGetLimits(t *testing.T) {
+	evenBooksDB(t)
+	ids := make([]int, maxBatchIDs+1)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	if _, status := batchGet(t, ids); status != http.StatusBadRequest {
+		t.Errorf("too many ids: status = %d", status)
+	}
+	if _, status := batchGet(t, []int{1, 0}); status != http.StatusBadRequest {
+		t.Errorf("out of range id: status = %d", status)
+	}
+	if books, status := batchGet(t, nil); status != http.StatusOK || len(books) != 0 {
+		t.Errorf("empty ids: got %d %v", status, books)
+	}
+}
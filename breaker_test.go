@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	now := testTime
+	b := newCircuitBreaker(2, 10*time.Second)
+	b.now = func() time.Time { return now }
+	down := errors.New("dial tcp: connection refused")
+
+	b.record(down)
+	if b.currentState() != breakerClosed || !b.allow() {
+		t.Fatalf("one failure: state = %s", b.currentState())
+	}
+	b.record(down)
+	if b.currentState() != breakerOpen || b.allow() {
+		t.Fatalf("threshold reached: state = %s", b.currentState())
+	}
+
+	now = now.Add(10 * time.Second)
+	if !b.allow() || b.currentState() != breakerHalfOpen {
+		t.Fatalf("after cooldown: state = %s, want a probe allowed", b.currentState())
+	}
+	if b.allow() {
+		t.Fatal("a second probe was allowed while the first is outstanding")
+	}
+	b.record(down)
+	if b.currentState() != breakerOpen || b.allow() {
+		t.Fatalf("failed probe: state = %s", b.currentState())
+	}
+
+	now = now.Add(10 * time.Second)
+	if !b.allow() {
+		t.Fatal("no probe after the second cooldown")
+	}
+	b.record(nil)
+	if b.currentState() != breakerClosed || !b.allow() || !b.allow() {
+		t.Fatalf("successful probe: state = %s", b.currentState())
+	}
+}
+
+func TestBreakerIgnoresQueryErrors(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute)
+	for _, err := range []error{sql.ErrNoRows, &mysql.MySQLError{Number: mysqlErrDuplicateEntry}, nil} {
+		b.record(err)
+		if b.currentState() != breakerClosed {
+			t.Fatalf("%v opened the breaker", err)
+		}
+	}
+}
+
+func TestOpenBreakerShortCircuitsRequests(t *testing.T) {
+	setForTest(t, &dbBreaker, newCircuitBreaker(2, time.Minute))
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{err: errors.New("dial tcp: connection refused")}
+	})
+	for i := 0; i < 2; i++ {
+		if w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil); w.Code != http.StatusInternalServerError {
+			t.Fatalf("failure %d: status = %d", i+1, w.Code)
+		}
+	}
+	if dbBreaker.currentState() != breakerOpen {
+		t.Fatalf("state = %s, want single-row reads recorded", dbBreaker.currentState())
+	}
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if n := len(fake.queries()); n != 2 {
+		t.Errorf("queries = %d, want none while open", n)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type bulkPatch struct {
+	Genre     *string `json:"genre"`
+	Publisher *string `json:"publisher"`
+	CoverURL  *string `json:"cover_url"`
+	Status    *string `json:"status"`
+	Language  *string `json:"language"`
+}
+
+func (p bulkPatch) setClause() (string, []interface{}, []string) {
+	var assignments []string
+	var args []interface{}
+	var errs []string
+	set := func(column string, value *string) {
+		if value != nil {
+			assignments = append(assignments, column+" = ?")
+			args = append(args, *value)
+		}
+	}
+	set("genre", p.Genre)
+	set("publisher", p.Publisher)
+	set("cover_url", p.CoverURL)
+	set("status", p.Status)
+	set("language", p.Language)
+	if p.Publisher != nil {
+		errs = append(errs, validatePublisher(*p.Publisher)...)
+	}
+	if p.CoverURL != nil && *p.CoverURL != "" && !isHTTPURL(*p.CoverURL) {
+		errs = append(errs, "cover_url must be an absolute http or https URL")
+	}
+	if p.Status != nil && *p.Status != statusDraft && *p.Status != statusPublished {
+		errs = append(errs, "status must be draft or published")
+	}
+	if p.Language != nil && *p.Language != "" && !isLanguageCode(*p.Language) {
+		errs = append(errs, fmt.Sprintf("language %q is not an ISO 639-1 code", *p.Language))
+	}
+	if len(assignments) == 0 {
+		errs = append(errs, "at least one field to update is required")
+	}
+	return strings.Join(assignments, ", "), args, errs
+}
+
+func handleBulkPatchBooks(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseBookFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.URL.Query().Get("status") == "" {
+		filter.Status = ""
+	}
+	conditions, whereArgs := filter.conditions()
+	if len(conditions) == 0 {
+		writeError(w, r, http.StatusBadRequest, "a bulk patch requires at least one filter: "+strings.Join(booksCapabilities.Filters, ", "))
+		return
+	}
+	var patch bulkPatch
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		log.Print(err)
+		writeError(w, r, http.StatusBadRequest, "invalid bulk patch payload: "+err.Error())
+		return
+	}
+	set, setArgs, errs := patch.setClause()
+	if len(errs) > 0 {
+		writeError(w, r, validationStatus(), strings.Join(errs, "; "))
+		return
+	}
+	updated, err := auditedBulkUpdate(requestActor(r), set, setArgs, strings.Join(conditions, " AND "), whereArgs)
+	if err != nil {
+		writeDBError(w, r, err, "could not update books")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, updatedCount{Updated: updated})
+}
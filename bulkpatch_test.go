@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// authorStore keeps books in memory and applies genre patches to the books
+// of the author named in the filter.
+func authorStore(books map[int]Book) func(string, []driver.Value) fakeResult {
+	store := bookStore(books, 0)
+	byAuthor := func(author driver.Value) []int {
+		var ids []int
+		for id := 1; id <= len(books); id++ {
+			if strings.EqualFold(books[id].Author, author.(string)) {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	return func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT "+bookColumns+" FROM books WHERE LOWER(author) = LOWER(?)"):
+			var matched []Book
+			for _, id := range byAuthor(args[0]) {
+				matched = append(matched, books[id])
+			}
+			return bookRows(matched...)
+		case strings.HasPrefix(query, "UPDATE books SET genre = ? WHERE LOWER(author) = LOWER(?)"):
+			ids := byAuthor(args[1])
+			for _, id := range ids {
+				book := books[id]
+				book.Genre = args[0].(string)
+				books[id] = book
+			}
+			return fakeResult{affected: int64(len(ids))}
+		}
+		return store(query, args)
+	}
+}
+
+func TestBulkPatchUpdatesOnlyMatchingAuthor(t *testing.T) {
+	setForTest(t, &apiUsername, "admin")
+	setForTest(t, &apiPassword, "secret")
+	books := map[int]Book{1: testBook(1, "Foundation"), 2: testBook(2, "I, Robot"), 3: testBook(3, "Emma")}
+	for _, id := range []int{1, 2} {
+		book := books[id]
+		book.Author = "Isaac Asimov"
+		books[id] = book
+	}
+	useFakeDB(t, authorStore(books))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPatch, "/api/books?author=Isaac+Asimov", `{"genre":"Science Fiction"}`,
+		map[string]string{"Authorization": "Basic YWRtaW46c2VjcmV0"})
+	if w.Code != http.StatusOK || w.Body.String() != `{"updated":2}`+"\n" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if books[1].Genre != "Science Fiction" || books[2].Genre != "Science Fiction" || books[3].Genre != "Programming" {
+		t.Errorf("genres = %q, %q, %q", books[1].Genre, books[2].Genre, books[3].Genre)
+	}
+}
+
+func TestBulkPatchRequiresFilter(t *testing.T) {
+	setForTest(t, &apiUsername, "admin")
+	setForTest(t, &apiPassword, "secret")
+	fake := useFakeDB(t, nil)
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPatch, "/api/books", `{"genre":"Science Fiction"}`,
+		map[string]string{"Authorization": "Basic YWRtaW46c2VjcmV0"})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "requires at least one filter") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
+
+func TestBulkPatchRequiresAuth(t *testing.T) {
+	setForTest(t, &apiUsername, "admin")
+	setForTest(t, &apiPassword, "secret")
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPatch, "/api/books?author=Isaac+Asimov", `{"genre":"Science Fiction"}`, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	listCacheFallback      = getEnvBool("LIST_CACHE_FALLBACK", false)
+	listCacheTTL           = getEnvDuration("LIST_CACHE_TTL", 10*time.Minute)
+	listCacheSweepInterval = getEnvDuration("LIST_CACHE_SWEEP_INTERVAL", time.Minute)
+)
+
+var errNoSnapshot = errors.New("database unavailable and no cached snapshot exists")
+
+type listSnapshot struct {
+	books    []Book
+	storedAt time.Time
+}
+
+type listSnapshotCache struct {
+	mu        sync.RWMutex
+	ttl       time.Duration
+	snapshots map[string]listSnapshot
+}
+
+var listSnapshots = &listSnapshotCache{ttl: listCacheTTL, snapshots: make(map[string]listSnapshot)}
+
+func (c *listSnapshotCache) store(key string, books []Book) {
+	c.mu.Lock()
+	c.snapshots[key] = listSnapshot{books: books, storedAt: time.Now()}
+	c.mu.Unlock()
+}
+
+func (c *listSnapshotCache) load(key string) ([]Book, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snapshot, ok := c.snapshots[key]
+	if !ok || time.Since(snapshot.storedAt) > c.ttl {
+		return nil, false
+	}
+	return snapshot.books, true
+}
+
+func (c *listSnapshotCache) sweep(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	evicted := 0
+	for key, snapshot := range c.snapshots {
+		if now.Sub(snapshot.storedAt) > c.ttl {
+			delete(c.snapshots, key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+func (c *listSnapshotCache) runSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if evicted := c.sweep(now); evicted > 0 {
+				log.Printf("evicted %d expired list snapshots", evicted)
+			}
+		}
+	}
+}
+
+func getBookListWithFallback(filter bookFilter) ([]Book, bool, error) {
+	books, err := getBookList(filter)
+	if !listCacheFallback {
+		return books, false, err
+	}
+	key := fmt.Sprintf("%+v", filter)
+	if err == nil {
+		listSnapshots.store(key, books)
+		return books, false, nil
+	}
+	if errors.Is(err, errTooManyRows) {
+		return nil, false, err
+	}
+	cached, ok := listSnapshots.load(key)
+	if !ok {
+		return nil, false, fmt.Errorf("%w: %w", errNoSnapshot, err)
+	}
+	log.Printf("serving cached book list after error: %v", err)
+	return cached, true, nil
+}
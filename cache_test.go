@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestListServedFromCacheWhenDBDown(t *testing.T) {
+	setForTest(t, &listCacheFallback, true)
+	setForTest(t, &listSnapshots, &listSnapshotCache{ttl: time.Minute, snapshots: make(map[string]listSnapshot)})
+	down := false
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if down {
+			return fakeResult{err: errors.New("connection refused")}
+		}
+		return bookRows(testBook(1, "Dune"))
+	})
+	first := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", nil)
+	if first.Code != http.StatusOK || first.Header().Get("X-Served-From-Cache") != "" {
+		t.Fatalf("live fetch: %d %v", first.Code, first.Header())
+	}
+	down = true
+	cached := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", nil)
+	if cached.Code != http.StatusOK || cached.Header().Get("X-Served-From-Cache") != "true" {
+		t.Fatalf("fallback: %d %v", cached.Code, cached.Header())
+	}
+	var books []Book
+	if err := json.Unmarshal(cached.Body.Bytes(), &books); err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 || books[0].BookName != "Dune" {
+		t.Errorf("cached books = %+v", books)
+	}
+
+	other := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?genre=History", "", nil)
+	if other.Code != http.StatusServiceUnavailable {
+		t.Errorf("uncached filter: status = %d, want 503", other.Code)
+	}
+}
+
+func TestListCacheFallbackOffByDefault(t *testing.T) {
+	setForTest(t, &listCacheFallback, false)
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{err: errors.New("connection refused")}
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestListSnapshotExpiresAfterTTL(t *testing.T) {
+	cache := &listSnapshotCache{ttl: time.Minute, snapshots: make(map[string]listSnapshot)}
+	cache.store("fresh", []Book{testBook(1, "Dune")})
+	cache.snapshots["stale"] = listSnapshot{books: []Book{testBook(2, "Emma")}, storedAt: time.Now().Add(-2 * time.Minute)}
+	if _, ok := cache.load("fresh"); !ok {
+		t.Error("fresh snapshot was not served")
+	}
+	if _, ok := cache.load("stale"); ok {
+		t.Error("expired snapshot was served")
+	}
+	if evicted := cache.sweep(time.Now()); evicted != 1 {
+		t.Errorf("evicted = %d, want 1", evicted)
+	}
+	if _, ok := cache.snapshots["stale"]; ok {
+		t.Error("expired snapshot is still held")
+	}
+	if _, ok := cache.snapshots["fresh"]; !ok {
+		t.Error("fresh snapshot was swept")
+	}
+}
+
+func TestListSnapshotSweeperStopsOnCancel(t *testing.T) {
+	cache := &listSnapshotCache{ttl: 10 * time.Millisecond, snapshots: make(map[string]listSnapshot)}
+	cache.store("books", []Book{testBook(1, "Dune")})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cache.runSweeper(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		cache.mu.RLock()
+		remaining := len(cache.snapshots)
+		cache.mu.RUnlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("sweeper did not evict the expired snapshot")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("sweeper kept running after cancel")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+var changesSafetyLag = getEnvDuration("CHANGES_SAFETY_LAG", 5*time.Second)
+
+type bookChanges struct {
+	Since    int64 `json:"since"`
+	Version  int64 `json:"version"`
+	HasMore  bool  `json:"has_more"`
+	Inserted []int `json:"inserted"`
+	Updated  []int `json:"updated"`
+	Deleted  []int `json:"deleted"`
+}
+
+func getBookChanges(since int64, limit int) (*bookChanges, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	results, err := queryContext(ctx, fmt.Sprintf(`SELECT id, bookid, action FROM %s_audit WHERE id > ? AND created_at <= NOW(6) - INTERVAL ? MICROSECOND ORDER BY id LIMIT ?`, booksTable),
+		since, changesSafetyLag.Microseconds(), limit+1)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	changes := &bookChanges{Since: since, Version: since, Inserted: make([]int, 0), Updated: make([]int, 0), Deleted: make([]int, 0)}
+	states := make(map[int]string)
+	var order []int
+	rows := 0
+	for results.Next() {
+		if rows++; rows > limit {
+			changes.HasMore = true
+			break
+		}
+		var version int64
+		var bookID int
+		var action string
+		if err := results.Scan(&version, &bookID, &action); err != nil {
+			return nil, err
+		}
+		changes.Version = version
+		previous, seen := states[bookID]
+		if !seen {
+			order = append(order, bookID)
+		}
+		switch {
+		case action == auditDelete:
+			states[bookID] = auditDelete
+		case previous == auditInsert && action == auditUpdate:
+		default:
+			states[bookID] = action
+		}
+	}
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+	for _, bookID := range order {
+		switch states[bookID] {
+		case auditInsert:
+			changes.Inserted = append(changes.Inserted, bookID)
+		case auditUpdate:
+			changes.Updated = append(changes.Updated, bookID)
+		case auditDelete:
+			changes.Deleted = append(changes.Deleted, bookID)
+		}
+	}
+	return changes, nil
+}
+
+func handleBookChanges(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var since int64
+		if value := r.URL.Query().Get("since"); value != "" {
+			var err error
+			since, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || since < 0 {
+				writeError(w, r, http.StatusBadRequest, "since must be a non-negative integer")
+				return
+			}
+		}
+		limit := defaultChangesLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+		}
+		if limit > maxChangesLimit {
+			limit = maxChangesLimit
+		}
+		changes, err := getBookChanges(since, limit)
+		if err != nil {
+			writeDBError(w, r, err, "could not list book changes")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, changes)
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
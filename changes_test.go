@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type changeRow struct {
+	id     int64
+	bookID int64
+	action string
+}
+
+// changeLogDB answers the change feed from rows the way the audit query
+// filters and limits them.
+func changeLogDB(t *testing.T, rows ...changeRow) *fakeDB {
+	return useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		result := fakeResult{columns: []string{"id", "bookid", "action"}}
+		for _, row := range rows {
+			if row.id > args[0].(int64) && len(result.rows) < int(args[2].(int64)) {
+				result.rows = append(result.rows, []driver.Value{row.id, row.bookID, row.action})
+			}
+		}
+		return result
+	})
+}
+
+func getChanges(t *testing.T, target string) bookChanges {
+	t.Helper()
+	w := serve(http.HandlerFunc(handleBookChanges), http.MethodGet, target, "", nil)
+	var changes bookChanges
+	if err := json.Unmarshal(w.Body.Bytes(), &changes); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	return changes
+}
+
+func TestChangesListInsertsUpdatesAndDeletes(t *testing.T) {
+	fake := changeLogDB(t,
+		changeRow{1, 10, auditInsert},
+		changeRow{2, 11, auditUpdate},
+		changeRow{3, 12, auditDelete},
+		changeRow{4, 13, auditInsert},
+		changeRow{5, 13, auditUpdate},
+		changeRow{6, 11, auditDelete},
+	)
+	changes := getChanges(t, "/api/books/changes")
+	got := fmt.Sprint(changes.Inserted, changes.Updated, changes.Deleted)
+	if got != "[10 13] [] [11 12]" || changes.Version != 6 || changes.HasMore {
+		t.Errorf("changes = %+v", changes)
+	}
+	feed, _ := fake.find("FROM books_audit")
+	if feed.args[1] != changesSafetyLag.Microseconds() {
+		t.Errorf("args = %v, want the safety lag applied", feed.args)
+	}
+
+	changes = getChanges(t, "/api/books/changes?since=3")
+	if got := fmt.Sprint(changes.Inserted, changes.Updated, changes.Deleted); got != "[13] [] [11]" || changes.Since != 3 {
+		t.Errorf("since 3: changes = %+v", changes)
+	}
+}
+
+func TestChangesPaginate(t *testing.T) {
+	changeLogDB(t, changeRow{1, 10, auditInsert}, changeRow{2, 11, auditUpdate}, changeRow{3, 12, auditDelete})
+	first := getChanges(t, "/api/books/changes?limit=2")
+	if !first.HasMore || first.Version != 2 || fmt.Sprint(first.Inserted, first.Updated) != "[10] [11]" {
+		t.Fatalf("first page = %+v", first)
+	}
+	next := getChanges(t, fmt.Sprintf("/api/books/changes?since=%d&limit=2", first.Version))
+	if next.HasMore || next.Version != 3 || fmt.Sprint(next.Deleted) != "[12]" {
+		t.Errorf("next page = %+v", next)
+	}
+}
+
+func TestSetupDBRejectsShortChangesLag(t *testing.T) {
+	setForTest(t, &changesSafetyLag, time.Second)
+	if err := SetupDB(); err == nil || !strings.Contains(err.Error(), "CHANGES_SAFETY_LAG") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var trustedProxies = parseCIDRs("TRUSTED_PROXIES", getEnv("TRUSTED_PROXIES", ""))
+
+func parseCIDRs(key, value string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(value, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("invalid %s entry %q, skipping", key, cidr)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func clientIP(r *http.Request) string {
+	host := remoteHost(r)
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrustedProxy(ip) {
+		return host
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		host = hop.String()
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPFromTrustedProxy(t *testing.T) {
+	setForTest(t, &trustedProxies, parseCIDRs("TRUSTED_PROXIES", "10.0.0.0/8"))
+	r := httptest.NewRequest("GET", "/api/books", nil)
+	r.RemoteAddr = "10.0.0.5:4321"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.9")
+	if got := clientIP(r); got != "198.51.100.7" {
+		t.Errorf("clientIP = %q, want the first untrusted hop", got)
+	}
+}
+
+func TestClientIPIgnoresUntrustedForwarding(t *testing.T) {
+	setForTest(t, &trustedProxies, parseCIDRs("TRUSTED_PROXIES", "10.0.0.0/8"))
+	r := httptest.NewRequest("GET", "/api/books", nil)
+	r.RemoteAddr = "203.0.113.4:4321"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	if got := clientIP(r); got != "203.0.113.4" {
+		t.Errorf("clientIP = %q, want the spoofable header ignored", got)
+	}
+}
+
+func TestParseCIDRsAcceptsBareAddresses(t *testing.T) {
+	networks := parseCIDRs("TRUSTED_PROXIES", "192.0.2.1, ::1, nonsense")
+	if len(networks) != 2 || networks[0].String() != "192.0.2.1/32" || networks[1].String() != "::1/128" {
+		t.Errorf("networks = %v", networks)
+	}
+}
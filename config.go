@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func getEnvOrFile(key, fallback string) (string, error) {
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		return readSecretFile(path)
+	}
+	return getEnv(key, fallback), nil
+}
+
+func databaseDSN() (string, error) {
+	dsn, err := getEnvOrFile("DB_DSN", "")
+	if err != nil || dsn != "" {
+		return dsn, err
+	}
+	password, err := getEnvOrFile("DB_PASSWORD", "root")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s",
+		getEnv("DB_USER", "root"),
+		password,
+		getEnv("DB_HOST", "127.0.0.1:3306"),
+		getEnv("DB_NAME", "bookdb")), nil
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid %s %q, using %t", key, value, fallback)
+		return fallback
+	}
+	return b
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return i
+}
+
+func replicaDSNs() []string {
+	var dsns []string
+	for _, dsn := range strings.Split(getEnv("DB_REPLICA_DSNS", ""), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			dsns = append(dsns, dsn)
+		}
+	}
+	return dsns
+}
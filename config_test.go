@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDatabaseDSNReadsPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_password")
+	if err := os.WriteFile(path, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_DSN", "")
+	t.Setenv("DB_PASSWORD", "from-env")
+	t.Setenv("DB_PASSWORD_FILE", path)
+	t.Setenv("DB_USER", "app")
+	t.Setenv("DB_HOST", "db:3306")
+	t.Setenv("DB_NAME", "bookdb")
+	dsn, err := databaseDSN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "app:s3cret@tcp(db:3306)/bookdb"; dsn != want {
+		t.Fatalf("dsn = %q, want %q", dsn, want)
+	}
+}
+
+func TestDatabaseDSNReadsDSNFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_dsn")
+	if err := os.WriteFile(path, []byte("u:p@tcp(h:3306)/d\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_DSN_FILE", path)
+	dsn, err := databaseDSN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsn != "u:p@tcp(h:3306)/d" {
+		t.Fatalf("dsn = %q", dsn)
+	}
+}
+
+func TestDatabaseDSNMissingPasswordFile(t *testing.T) {
+	t.Setenv("DB_DSN", "")
+	t.Setenv("DB_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := databaseDSN(); err == nil {
+		t.Fatal("expected an error for a missing password file")
+	}
+}
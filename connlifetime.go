@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"math/rand"
+	"time"
+)
+
+func jitteredLifetime(base, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return base
+	}
+	if jitter > base {
+		jitter = base
+	}
+	return base - jitter + time.Duration(rand.Int63n(int64(2*jitter)+1))
+}
+
+type jitterConnector struct {
+	connector driver.Connector
+	base      time.Duration
+	jitter    time.Duration
+	now       func() time.Time
+}
+
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func openJitteredDB(driverName, dsn string, base, jitter time.Duration) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil || jitter <= 0 {
+		return db, err
+	}
+	d := db.Driver()
+	db.Close()
+	var connector driver.Connector = dsnConnector{dsn: dsn, driver: d}
+	if dc, ok := d.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return sql.OpenDB(&jitterConnector{connector: connector, base: base, jitter: jitter, now: time.Now}), nil
+}
+
+func (c *jitterConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &jitterConn{Conn: conn, expiresAt: c.now().Add(jitteredLifetime(c.base, c.jitter)), now: c.now}, nil
+}
+
+func (c *jitterConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+type jitterConn struct {
+	driver.Conn
+	expiresAt time.Time
+	now       func() time.Time
+}
+
+func (c *jitterConn) expired() bool {
+	return !c.now().Before(c.expiresAt)
+}
+
+func (c *jitterConn) IsValid() bool {
+	if c.expired() {
+		return false
+	}
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// ResetSession runs when an idle connection is taken from the pool, which
+// is the only chance to drop one that expired while it sat there.
+func (c *jitterConn) ResetSession(ctx context.Context) error {
+	if c.expired() {
+		return driver.ErrBadConn
+	}
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *jitterConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *jitterConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *jitterConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *jitterConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *jitterConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *jitterConn) CheckNamedValue(value *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestJitteredLifetimeStaysInBand(t *testing.T) {
+	base, jitter := 3*time.Minute, 30*time.Second
+	for i := 0; i < 1000; i++ {
+		if got := jitteredLifetime(base, jitter); got < base-jitter || got > base+jitter {
+			t.Fatalf("lifetime %v outside %v±%v", got, base, jitter)
+		}
+	}
+	if got := jitteredLifetime(base, 0); got != base {
+		t.Errorf("no jitter: lifetime = %v", got)
+	}
+	for i := 0; i < 100; i++ {
+		if got := jitteredLifetime(time.Minute, time.Hour); got < 0 || got > 2*time.Minute {
+			t.Fatalf("jitter wider than base: lifetime = %v", got)
+		}
+	}
+}
+
+func TestJitterConnExpiresPerConnection(t *testing.T) {
+	_, fake := openFakeDB(t, t.Name(), func(query string, args []driver.Value) fakeResult {
+		return fakeResult{columns: []string{"1"}, rows: [][]driver.Value{{int64(1)}}}
+	})
+	now := testTime
+	connector := &jitterConnector{
+		connector: dsnConnector{dsn: t.Name(), driver: fakeDriver{}},
+		base:      time.Minute,
+		jitter:    10 * time.Second,
+		now:       func() time.Time { return now },
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	ping := func() {
+		t.Helper()
+		var one int
+		if err := db.QueryRowContext(context.Background(), "SELECT 1").Scan(&one); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ping()
+	now = now.Add(49 * time.Second)
+	ping()
+	if fake.opens != 1 {
+		t.Fatalf("opens = %d, want the connection reused before the band", fake.opens)
+	}
+	now = now.Add(22 * time.Second)
+	ping()
+	if fake.opens != 2 {
+		t.Errorf("opens = %d, want the connection replaced after the band", fake.opens)
+	}
+}
+
+func TestOpenJitteredDBWrapsDriver(t *testing.T) {
+	_, fake := openFakeDB(t, t.Name(), nil)
+	db, err := openJitteredDB("fakedb", t.Name(), time.Minute, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("DO 1"); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*jitterConn)
+		if !ok {
+			t.Fatalf("driver conn = %T, want *jitterConn", driverConn)
+		}
+		if lifetime := c.expiresAt.Sub(time.Now()); lifetime < 49*time.Second || lifetime > 70*time.Second {
+			t.Errorf("lifetime = %v", lifetime)
+		}
+		return nil
+	})
+	if _, ok := fake.find("DO 1"); !ok {
+		t.Errorf("statement did not reach the driver: %v", fake.queries())
+	}
+}
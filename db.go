@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var readReplicas []*sql.DB
+
+var replicaCursor uint32
+
+func readDB() *sql.DB {
+	if len(readReplicas) == 0 {
+		return Db
+	}
+	n := atomic.AddUint32(&replicaCursor, 1)
+	return readReplicas[(n-1)%uint32(len(readReplicas))]
+}
+
+var debugSQL = getEnvBool("DEBUG_SQL", false)
+
+const dbTimeout = 3 * time.Second
+
+var dbSlots = newDBSlots(getEnvInt("DB_MAX_CONCURRENT", 0))
+
+var errDBBusy = errors.New("too many concurrent database operations")
+
+var (
+	writeRetries = getEnvInt("DB_WRITE_RETRIES", 3)
+	retryBackoff = getEnvDuration("DB_RETRY_BACKOFF", 50*time.Millisecond)
+)
+
+const (
+	mysqlErrDuplicateEntry  = 1062
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+)
+
+func mysqlErrorNumber(err error) uint16 {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number
+	}
+	return 0
+}
+
+func isDuplicateTitleError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != mysqlErrDuplicateEntry {
+		return false
+	}
+	return strings.Contains(mysqlErr.Message, uniqueTitleIndex())
+}
+
+func isRetryableWriteError(err error) bool {
+	switch mysqlErrorNumber(err) {
+	case mysqlErrDeadlock, mysqlErrLockWaitTimeout:
+		return true
+	}
+	return false
+}
+
+func retryWrites(ctx context.Context, op func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || !isRetryableWriteError(err) || attempt >= writeRetries {
+			return err
+		}
+		log.Printf("retrying write after %v (attempt %d)", err, attempt+1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryBackoff << attempt):
+		}
+	}
+}
+
+func newDBSlots(limit int) chan struct{} {
+	if limit <= 0 {
+		return nil
+	}
+	return make(chan struct{}, limit)
+}
+
+var txIsolation = getEnv("DB_TX_ISOLATION", "")
+
+var isolationLevels = map[string]sql.IsolationLevel{
+	"":                 sql.LevelDefault,
+	"READ UNCOMMITTED": sql.LevelReadUncommitted,
+	"READ COMMITTED":   sql.LevelReadCommitted,
+	"REPEATABLE READ":  sql.LevelRepeatableRead,
+	"SERIALIZABLE":     sql.LevelSerializable,
+}
+
+func parseIsolationLevel(value string) (sql.IsolationLevel, error) {
+	name := strings.ToUpper(strings.Join(strings.Fields(strings.ReplaceAll(value, "_", " ")), " "))
+	level, ok := isolationLevels[name]
+	if !ok {
+		return sql.LevelDefault, fmt.Errorf("unsupported transaction isolation level %q", value)
+	}
+	return level, nil
+}
+
+func txOptions() *sql.TxOptions {
+	level, err := parseIsolationLevel(txIsolation)
+	if err != nil {
+		log.Print(err)
+	}
+	return &sql.TxOptions{Isolation: level}
+}
+
+func logQuery(query string, args []interface{}) {
+	if debugSQL {
+		log.Printf("sql: %s args=%v", query, args)
+	}
+}
+
+func queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	logQuery(query, args)
+	rows, err := Db.QueryContext(ctx, query, args...)
+	dbBreaker.record(err)
+	return rows, err
+}
+
+type recordedRow struct {
+	row *sql.Row
+}
+
+func (r recordedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	dbBreaker.record(err)
+	return err
+}
+
+func queryRowContext(ctx context.Context, query string, args ...interface{}) rowScanner {
+	logQuery(query, args)
+	return recordedRow{Db.QueryRowContext(ctx, query, args...)}
+}
+
+func readQueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	logQuery(query, args)
+	rows, err := readDB().QueryContext(ctx, query, args...)
+	dbBreaker.record(err)
+	return rows, err
+}
+
+func readQueryRowContext(ctx context.Context, query string, args ...interface{}) rowScanner {
+	logQuery(query, args)
+	return recordedRow{readDB().QueryRowContext(ctx, query, args...)}
+}
+
+func execContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	logQuery(query, args)
+	var result sql.Result
+	err := retryWrites(ctx, func() error {
+		var err error
+		result, err = Db.ExecContext(ctx, query, args...)
+		return err
+	})
+	dbBreaker.record(err)
+	return result, err
+}
+
+func beginTx(ctx context.Context) (*sql.Tx, error) {
+	tx, err := Db.BeginTx(ctx, txOptions())
+	dbBreaker.record(err)
+	return tx, err
+}
+
+var (
+	connMaxLifetime    = getEnvDuration("DB_CONN_MAX_LIFETIME", 3*time.Minute)
+	connLifetimeJitter = getEnvDuration("DB_CONN_LIFETIME_JITTER", 0)
+)
+
+var (
+	poolRampPeriod = getEnvDuration("DB_POOL_RAMP", 0)
+	poolRampStart  = getEnvInt("DB_POOL_RAMP_START", 1)
+)
+
+func rampedConns(start, max int, elapsed, period time.Duration) int {
+	if elapsed >= period || start >= max {
+		return max
+	}
+	return start + int(int64(max-start)*int64(elapsed)/int64(period))
+}
+
+func setPoolSize(db *sql.DB, n int) {
+	db.SetMaxOpenConns(n)
+	if n > dbMaxIdleConns {
+		n = dbMaxIdleConns
+	}
+	db.SetMaxIdleConns(n)
+}
+
+func runPoolRamp(db *sql.DB, start, max int, period time.Duration) {
+	begin := time.Now()
+	current := start
+	setPoolSize(db, current)
+	ticker := time.NewTicker(period / time.Duration(max-start+1))
+	defer ticker.Stop()
+	for range ticker.C {
+		n := rampedConns(start, max, time.Since(begin), period)
+		if n != current {
+			current = n
+			setPoolSize(db, current)
+		}
+		if current >= max {
+			return
+		}
+	}
+}
+
+func dbContext() (context.Context, context.CancelFunc, error) {
+	if !dbBreaker.allow() {
+		return nil, nil, errCircuitOpen
+	}
+	if dbSlots != nil {
+		select {
+		case dbSlots <- struct{}{}:
+		default:
+			return nil, nil, errDBBusy
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	return ctx, func() {
+		cancel()
+		if dbSlots != nil {
+			<-dbSlots
+		}
+	}, nil
+}
+
+func warmPool(ctx context.Context, db *sql.DB, n int) (int, error) {
+	if n > dbMaxIdleConns {
+		n = dbMaxIdleConns
+	}
+	if open := db.Stats().MaxOpenConnections; open > 0 && n > open {
+		n = open
+	}
+	conns := make([]*sql.Conn, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			conns[i] = conn
+			errs[i] = conn.PingContext(ctx)
+		}(i)
+	}
+	wg.Wait()
+	warmed := 0
+	for _, conn := range conns {
+		if conn != nil {
+			conn.Close()
+			warmed++
+		}
+	}
+	return warmed, errors.Join(errs...)
+}
+
+func txExecContext(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	logQuery(query, args)
+	result, err := tx.ExecContext(ctx, query, args...)
+	dbBreaker.record(err)
+	return result, err
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return &buf
+}
+
+func TestDebugSQLLogsQueries(t *testing.T) {
+	setForTest(t, &debugSQL, true)
+	useFakeDB(t, bookStore(nil, 0))
+	logs := captureLog(t)
+	if _, err := getBook(42); err != nil {
+		t.Fatal(err)
+	}
+	if got := logs.String(); !strings.Contains(got, "sql: SELECT bookid") || !strings.Contains(got, "args=[42]") {
+		t.Fatalf("log = %q", got)
+	}
+}
+
+func TestDebugSQLSilentByDefault(t *testing.T) {
+	setForTest(t, &debugSQL, false)
+	useFakeDB(t, bookStore(nil, 0))
+	logs := captureLog(t)
+	if _, err := execContext(context.Background(), "UPDATE books SET stock = 0"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), "sql:") {
+		t.Fatalf("log = %q", logs.String())
+	}
+}
+
+func TestTxIsolationLevelApplied(t *testing.T) {
+	setForTest(t, &txIsolation, "read_committed")
+	if got := txOptions().Isolation; got != sql.LevelReadCommitted {
+		t.Fatalf("isolation = %v", got)
+	}
+	fake := useFakeDB(t, bookStore(nil, 0))
+	tx, err := beginTx(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	if len(fake.isolations) != 1 || fake.isolations[0] != driver.IsolationLevel(sql.LevelReadCommitted) {
+		t.Fatalf("isolations = %v", fake.isolations)
+	}
+}
+
+func TestSetupDBRejectsUnsupportedIsolation(t *testing.T) {
+	setForTest(t, &txIsolation, "snapshot")
+	if err := SetupDB(); err == nil || !strings.Contains(err.Error(), "isolation") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestParseIsolationLevel(t *testing.T) {
+	for value, want := range map[string]sql.IsolationLevel{
+		"":                sql.LevelDefault,
+		"repeatable read": sql.LevelRepeatableRead,
+		"SERIALIZABLE":    sql.LevelSerializable,
+	} {
+		if got, err := parseIsolationLevel(value); err != nil || got != want {
+			t.Errorf("parseIsolationLevel(%q) = %v, %v", value, got, err)
+		}
+	}
+	if _, err := parseIsolationLevel("snapshot"); err == nil {
+		t.Error("expected an error for an unsupported level")
+	}
+}
+
+func TestReadsRoundRobinAcrossReplicas(t *testing.T) {
+	primary := useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	first, firstFake := openFakeDB(t, t.Name()+"/replica1", bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	second, secondFake := openFakeDB(t, t.Name()+"/replica2", bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	readReplicas = []*sql.DB{first, second}
+	for i := 0; i < 4; i++ {
+		book, err := getBook(1)
+		if err != nil || book == nil {
+			t.Fatalf("getBook = %v, %v", book, err)
+		}
+	}
+	if n := len(firstFake.queries()); n != 2 {
+		t.Errorf("replica 1 served %d reads, want 2", n)
+	}
+	if n := len(secondFake.queries()); n != 2 {
+		t.Errorf("replica 2 served %d reads, want 2", n)
+	}
+	if n := len(primary.queries()); n != 0 {
+		t.Errorf("primary served %d reads, want 0", n)
+	}
+
+	if err := setBookStatus(1, statusDraft, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := primary.find("UPDATE books SET status = ?"); !ok {
+		t.Errorf("write did not reach the primary: %v", primary.queries())
+	}
+	if len(firstFake.queries())+len(secondFake.queries()) != 4 {
+		t.Error("write reached a replica")
+	}
+}
+
+func TestReadsFallBackToPrimary(t *testing.T) {
+	primary := useFakeDB(t, bookStore(nil, 0))
+	if _, err := getBook(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.queries()) != 1 {
+		t.Errorf("queries = %v", primary.queries())
+	}
+}
+
+func TestReplicaDSNs(t *testing.T) {
+	t.Setenv("DB_REPLICA_DSNS", " u:p@tcp(r1)/db , ,u:p@tcp(r2)/db")
+	if got := strings.Join(replicaDSNs(), "|"); got != "u:p@tcp(r1)/db|u:p@tcp(r2)/db" {
+		t.Fatalf("replicaDSNs = %q", got)
+	}
+}
+
+func TestSaturatedDBSlotsReturn503(t *testing.T) {
+	setForTest(t, &dbSlots, newDBSlots(1))
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	_, release, err := dbContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	release()
+	w = serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("after release: status = %d", w.Code)
+	}
+}
+
+func TestDBSlotsDisabledByDefault(t *testing.T) {
+	if newDBSlots(0) != nil {
+		t.Fatal("a zero limit should disable the semaphore")
+	}
+}
+
+func TestWarmPoolOpensConnections(t *testing.T) {
+	db, fake := openFakeDB(t, t.Name(), nil)
+	db.SetMaxIdleConns(dbMaxIdleConns)
+	warmed, err := warmPool(context.Background(), db, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warmed != 4 || fake.opens != 4 {
+		t.Fatalf("warmed = %d, opened = %d, want 4", warmed, fake.opens)
+	}
+	if idle := db.Stats().Idle; idle != 4 {
+		t.Errorf("idle = %d, want the warmed connections kept in the pool", idle)
+	}
+}
+
+func TestWarmPoolCapsAtIdleLimit(t *testing.T) {
+	db, _ := openFakeDB(t, t.Name(), nil)
+	db.SetMaxIdleConns(dbMaxIdleConns)
+	db.SetMaxOpenConns(3)
+	warmed, err := warmPool(context.Background(), db, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warmed != 3 {
+		t.Fatalf("warmed = %d, want the max open limit of 3", warmed)
+	}
+}
+
+func TestWriteRetriesDeadlockOnce(t *testing.T) {
+	setForTest(t, &retryBackoff, time.Millisecond)
+	deadlocked := false
+	store := bookStore(nil, 5)
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "INSERT INTO books ") && !deadlocked {
+			deadlocked = true
+			return fakeResult{err: &mysql.MySQLError{Number: mysqlErrDeadlock, Message: "Deadlock found"}}
+		}
+		return store(query, args)
+	})
+	id, err := insertBook(testBook(0, "Dune"), "tester")
+	if err != nil || id != 5 {
+		t.Fatalf("insertBook = %d, %v", id, err)
+	}
+	inserts := 0
+	for _, query := range fake.queries() {
+		if strings.HasPrefix(query, "INSERT INTO books ") {
+			inserts++
+		}
+	}
+	if inserts != 2 || fake.commits != 1 {
+		t.Errorf("inserts = %d, commits = %d, want one retry then a commit", inserts, fake.commits)
+	}
+}
+
+func TestWriteGivesUpAfterRetries(t *testing.T) {
+	setForTest(t, &retryBackoff, time.Millisecond)
+	setForTest(t, &writeRetries, 2)
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "INSERT INTO books ") {
+			return fakeResult{err: &mysql.MySQLError{Number: mysqlErrLockWaitTimeout, Message: "Lock wait timeout exceeded"}}
+		}
+		return fakeResult{}
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert"}`, nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if n := len(fake.queries()); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+}
+
+func TestDeadlockAfterRetriesIsConflict(t *testing.T) {
+	setForTest(t, &retryBackoff, time.Millisecond)
+	setForTest(t, &writeRetries, 0)
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "INSERT INTO books ") {
+			return fakeResult{err: &mysql.MySQLError{Number: mysqlErrDeadlock, Message: "Deadlock found"}}
+		}
+		return fakeResult{}
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert"}`, nil)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", w.Code)
+	}
+}
+
+func TestDuplicateTitleByAuthorIsConflict(t *testing.T) {
+	store := &insertStore{nextID: 1}
+	store.fail = func(book Book) error {
+		for _, existing := range store.books {
+			if existing.BookName == book.BookName && existing.Author == book.Author {
+				return &mysql.MySQLError{Number: mysqlErrDuplicateEntry, Message: "Duplicate entry 'Dune-Frank Herbert' for key 'books.uq_books_bookname_author'"}
+			}
+		}
+		return nil
+	}
+	useFakeDB(t, store.handle)
+	body := `{"bookname":"Dune","author":"Frank Herbert"}`
+	if w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", body, nil); w.Code != http.StatusCreated {
+		t.Fatalf("first insert = %d: %s", w.Code, w.Body.String())
+	}
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", body, nil)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "a book with this title by this author already exists") {
+		t.Fatalf("second insert = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDuplicateBookIDIsDistinctConflict(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "INSERT INTO books ") {
+			return fakeResult{err: &mysql.MySQLError{Number: mysqlErrDuplicateEntry, Message: "Duplicate entry '7' for key 'books.PRIMARY'"}}
+		}
+		return fakeResult{}
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookid":7,"bookname":"Dune","author":"Frank Herbert"}`, nil)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "a book with this bookid already exists") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRampedConns(t *testing.T) {
+	for _, c := range []struct {
+		elapsed time.Duration
+		want    int
+	}{
+		{0, 2}, {25 * time.Second, 4}, {50 * time.Second, 6}, {99 * time.Second, 9}, {100 * time.Second, 10}, {time.Hour, 10},
+	} {
+		if got := rampedConns(2, 10, c.elapsed, 100*time.Second); got != c.want {
+			t.Errorf("rampedConns at %v = %d, want %d", c.elapsed, got, c.want)
+		}
+	}
+}
+
+func TestPoolRampRaisesMaxOpenConns(t *testing.T) {
+	db, _ := openFakeDB(t, t.Name(), nil)
+	done := make(chan struct{})
+	go func() {
+		runPoolRamp(db, 1, 5, 100*time.Millisecond)
+		close(done)
+	}()
+	seen := []int{}
+	deadline := time.After(2 * time.Second)
+	for {
+		n := db.Stats().MaxOpenConnections
+		if len(seen) == 0 || seen[len(seen)-1] != n {
+			seen = append(seen, n)
+		}
+		select {
+		case <-done:
+			if last := db.Stats().MaxOpenConnections; last != 5 {
+				t.Fatalf("final max open = %d, seen %v", last, seen)
+			}
+			for i := 1; i < len(seen); i++ {
+				if seen[i] < seen[i-1] {
+					t.Fatalf("max open went down: %v", seen)
+				}
+			}
+			if len(seen) < 3 {
+				t.Errorf("seen %v, want intermediate steps during the ramp", seen)
+			}
+			return
+		case <-deadline:
+			t.Fatalf("ramp did not finish, seen %v", seen)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+)
+
+var debugEndpoints = getEnvBool("DEBUG_ENDPOINTS", false)
+
+type dbStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDurationMs     int64  `json:"wait_duration_ms"`
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+	CircuitBreaker     string `json:"circuit_breaker"`
+}
+
+func debugMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !debugEndpoints {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func handleDBStats(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stats := Db.Stats()
+		writeJSON(w, r, http.StatusOK, dbStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+			CircuitBreaker:     dbBreaker.currentState(),
+		})
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
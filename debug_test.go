@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDBStatsShape(t *testing.T) {
+	setForTest(t, &debugEndpoints, true)
+	useFakeDB(t, nil)
+	Db.SetMaxOpenConns(7)
+	w := serve(debugMiddleware(http.HandlerFunc(handleDBStats)), http.MethodGet, "/api/debug/dbstats", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var stats map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	want := "circuit_breaker,idle,in_use,max_idle_closed,max_lifetime_closed,max_open_connections,open_connections,wait_count,wait_duration_ms"
+	if got := strings.Join(keys, ","); got != want {
+		t.Errorf("keys = %s", got)
+	}
+	if stats["max_open_connections"] != float64(7) {
+		t.Errorf("max_open_connections = %v", stats["max_open_connections"])
+	}
+}
+
+func TestDBStatsHiddenWhenDebugOff(t *testing.T) {
+	setForTest(t, &debugEndpoints, false)
+	w := serve(debugMiddleware(http.HandlerFunc(handleDBStats)), http.MethodGet, "/api/debug/dbstats", "", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var dedupWindow = getEnvDuration("WRITE_DEDUP_WINDOW", 0)
+
+type dedupEntry struct {
+	done   chan struct{}
+	status int
+	header http.Header
+	body   []byte
+}
+
+var (
+	dedupMu      sync.Mutex
+	dedupEntries = make(map[string]*dedupEntry)
+)
+
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func dedupKey(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, clientIP(r)+"\n"+r.Method+"\n"+r.URL.RequestURI()+"\n"+r.Header.Get("Authorization")+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replayDedup(w http.ResponseWriter, entry *dedupEntry) {
+	for key, values := range entry.header {
+		w.Header()[key] = values
+	}
+	w.Header().Set("X-Deduplicated", "true")
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
+
+func dedupMiddleware(handler http.Handler) http.Handler {
+	if dedupWindow <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWriteMethod(r.Method) || r.Body == nil || strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+		r.Body.Close()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "could not read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		key := dedupKey(r, body)
+		dedupMu.Lock()
+		if entry, ok := dedupEntries[key]; ok {
+			dedupMu.Unlock()
+			select {
+			case <-entry.done:
+			case <-r.Context().Done():
+				return
+			}
+			if entry.status != 0 {
+				replayDedup(w, entry)
+				return
+			}
+			handler.ServeHTTP(w, r)
+			return
+		}
+		entry := &dedupEntry{done: make(chan struct{})}
+		dedupEntries[key] = entry
+		dedupMu.Unlock()
+		rec := &bodyRecorder{ResponseWriter: w, limit: math.MaxInt}
+		defer func() {
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			if rec.status < http.StatusInternalServerError {
+				entry.status, entry.header, entry.body = rec.status, w.Header().Clone(), rec.body.Bytes()
+				time.AfterFunc(dedupWindow, func() {
+					dedupMu.Lock()
+					delete(dedupEntries, key)
+					dedupMu.Unlock()
+				})
+			} else {
+				dedupMu.Lock()
+				delete(dedupEntries, key)
+				dedupMu.Unlock()
+			}
+			close(entry.done)
+		}()
+		handler.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDuplicatePostInsertsOnce(t *testing.T) {
+	setForTest(t, &dedupWindow, time.Minute)
+	store := &insertStore{nextID: 6}
+	useFakeDB(t, store.handle)
+	handler := dedupMiddleware(http.HandlerFunc(handleBooks))
+	body := `{"bookname":"Dune","author":"Frank Herbert"}`
+	first := serve(handler, http.MethodPost, "/api/books?dedup=once", body, nil)
+	second := serve(handler, http.MethodPost, "/api/books?dedup=once", body, nil)
+	if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+		t.Fatalf("statuses = %d, %d", first.Code, second.Code)
+	}
+	if store.inserts != 1 {
+		t.Errorf("inserts = %d, want 1", store.inserts)
+	}
+	if second.Header().Get("X-Deduplicated") != "true" || second.Header().Get("Location") != first.Header().Get("Location") {
+		t.Errorf("replay headers = %v", second.Header())
+	}
+	serve(handler, http.MethodPost, "/api/books?dedup=once", `{"bookname":"Emma","author":"Jane Austen"}`, nil)
+	if store.inserts != 2 {
+		t.Errorf("inserts = %d, want a different body to go through", store.inserts)
+	}
+}
+
+func TestConcurrentDuplicatesWaitForFirst(t *testing.T) {
+	setForTest(t, &dedupWindow, time.Minute)
+	var calls int32
+	release := make(chan struct{})
+	handler := dedupMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+	var wg sync.WaitGroup
+	codes := make([]int, 3)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serve(handler, http.MethodPost, "/api/books?dedup=concurrent", "{}", nil).Code
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+	for i, code := range codes {
+		if code != http.StatusCreated {
+			t.Errorf("request %d: status = %d", i, code)
+		}
+	}
+}
+
+func TestDedupWindowExpires(t *testing.T) {
+	setForTest(t, &dedupWindow, 10*time.Millisecond)
+	var calls int32
+	handler := dedupMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	serve(handler, http.MethodPost, "/api/books?dedup=expires", "{}", nil)
+	time.Sleep(50 * time.Millisecond)
+	serve(handler, http.MethodPost, "/api/books?dedup=expires", "{}", nil)
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want the window to have expired", calls)
+	}
+}
+
+func TestDedupOffByDefault(t *testing.T) {
+	setForTest(t, &dedupWindow, 0)
+	var calls int32
+	handler := dedupMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	serve(handler, http.MethodPost, "/api/books?dedup=off", "{}", nil)
+	serve(handler, http.MethodPost, "/api/books?dedup=off", "{}", nil)
+	if calls != 2 {
+		t.Errorf("handler ran %d times", calls)
+	}
+}
+
+func TestDedupBoundsTheBodyAndSkipsUploads(t *testing.T) {
+	setForTest(t, &dedupWindow, time.Minute)
+	var calls int32
+	handler := dedupMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	w := serve(handler, http.MethodPost, "/api/books?dedup=large", strings.Repeat("x", maxImportSize+1), nil)
+	if w.Code != http.StatusRequestEntityTooLarge || calls != 0 {
+		t.Fatalf("oversized body: got %d after %d calls", w.Code, calls)
+	}
+	upload := map[string]string{"Content-Type": "multipart/form-data; boundary=x"}
+	serve(handler, http.MethodPost, "/api/books/import?dedup=upload", "--x--", upload)
+	serve(handler, http.MethodPost, "/api/books/import?dedup=upload", "--x--", upload)
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want uploads passed through", calls)
+	}
+}
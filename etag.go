@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func computeETag(body []byte) string {
+	return fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, v interface{}) {
+	j, err := marshalResponse(responsePayload(r, v))
+	if err != nil {
+		log.Print(err)
+		writeError(w, r, http.StatusInternalServerError, "could not encode response")
+		return
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	etag := computeETag(j)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(j)))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(j)
+	if err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"testing"
+)
+
+func TestListETagAndNotModified(t *testing.T) {
+	books := []Book{testBook(1, "Dune")}
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(books...)
+	})
+	first := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("got %d with ETag %q", first.Code, etag)
+	}
+	second := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", map[string]string{"If-None-Match": etag})
+	if second.Code != http.StatusNotModified || second.Body.Len() != 0 {
+		t.Fatalf("got %d %q, want an empty 304", second.Code, second.Body.String())
+	}
+	if second.Header().Get("ETag") != etag {
+		t.Errorf("304 ETag = %q", second.Header().Get("ETag"))
+	}
+
+	books = append(books, testBook(2, "Emma"))
+	third := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", map[string]string{"If-None-Match": etag})
+	if third.Code != http.StatusOK || third.Header().Get("ETag") == etag {
+		t.Fatalf("changed list: got %d with ETag %q", third.Code, third.Header().Get("ETag"))
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := `"abc"`
+	for header, want := range map[string]bool{
+		`"abc"`:      true,
+		`W/"abc"`:    true,
+		`"x", "abc"`: true,
+		`*`:          true,
+		`"abcd"`:     false,
+		``:           false,
+	} {
+		if got := etagMatches(header, etag); got != want {
+			t.Errorf("etagMatches(%q) = %t", header, got)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const sseKeepAlive = 30 * time.Second
+
+type bookEvent struct {
+	Type   string `json:"type"`
+	BookID int    `json:"bookid"`
+}
+
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan bookEvent]struct{}
+}
+
+var bookEvents = &eventBroker{subscribers: make(map[chan bookEvent]struct{})}
+
+func (b *eventBroker) subscribe() chan bookEvent {
+	ch := make(chan bookEvent, 16)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan bookEvent) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+}
+
+func (b *eventBroker) publish(event bookEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("dropping %s event for book %d on slow subscriber", event.Type, event.BookID)
+		}
+	}
+}
+
+var auditEventTypes = map[string]string{
+	auditInsert: "created",
+	auditUpdate: "updated",
+	auditDelete: "deleted",
+}
+
+func publishBookChange(action string, bookID int) {
+	bookEvents.publish(bookEvent{Type: auditEventTypes[action], BookID: bookID})
+}
+
+func handleBookEvents(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, r, http.StatusInternalServerError, "streaming is not supported")
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		events := bookEvents.subscribe()
+		defer bookEvents.unsubscribe(events)
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			case event := <-events:
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Print(err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			}
+			flusher.Flush()
+		}
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
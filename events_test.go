@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func subscriberCount() int {
+	bookEvents.mu.Lock()
+	defer bookEvents.mu.Unlock()
+	return len(bookEvents.subscribers)
+}
+
+func TestEventsStreamReceivesInsert(t *testing.T) {
+	useFakeDB(t, bookStore(nil, 42))
+	server := httptest.NewServer(http.HandlerFunc(handleBookEvents))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	for subscriberCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := insertBook(testBook(0, "Dune"), "tester"); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(response.Body)
+	var lines []string
+	for len(lines) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read after %q: %v", lines, err)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if lines[0] != "event: created" || lines[1] != `data: {"type":"created","bookid":42}` {
+		t.Fatalf("event = %q", lines)
+	}
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for subscriberCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if subscriberCount() != 0 {
+		t.Error("subscriber was not removed after the client disconnected")
+	}
+}
+
+func TestSlowSubscriberDoesNotBlockPublish(t *testing.T) {
+	broker := &eventBroker{subscribers: make(map[chan bookEvent]struct{})}
+	events := broker.subscribe()
+	defer broker.unsubscribe(events)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < cap(events)+5; i++ {
+			broker.publish(bookEvent{Type: "updated", BookID: i})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a full subscriber")
+	}
+	if len(events) != cap(events) {
+		t.Errorf("buffered %d events, want %d", len(events), cap(events))
+	}
+}
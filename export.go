@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var bulkSlots = newDBSlots(getEnvInt("MAX_CONCURRENT_BULK", 2))
+
+func bulkLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if bulkSlots == nil || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+		select {
+		case bulkSlots <- struct{}{}:
+		default:
+			setRetryAfter(w, time.Second)
+			writeError(w, r, http.StatusTooManyRequests, "too many concurrent exports or imports")
+			return
+		}
+		defer func() { <-bulkSlots }()
+		next(w, r)
+	}
+}
+
+var exportColumns = strings.Split(strings.ReplaceAll(bookInsertColumns, " ", ""), ",")
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case Timestamp:
+		return v.Time.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// exportSpool holds an export encoded to a temporary file, so the result set
+// is never held in memory and the response can still answer Range requests.
+type exportSpool struct {
+	file     *os.File
+	etag     string
+	modified time.Time
+}
+
+func (s *exportSpool) Close() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+func exportEncoder(out io.Writer, format string, fields []string) (func(*Book) error, func() error) {
+	if format == "csv" {
+		columns := exportColumns
+		if len(fields) > 0 {
+			columns = orderedFields(fields)
+		}
+		writer := csv.NewWriter(out)
+		writer.Write(columns)
+		row := make([]string, len(columns))
+		encode := func(book *Book) error {
+			all := bookScanDest(book)
+			for j, column := range columns {
+				row[j] = csvValue(scanDestValue(all[bookColumnIndex(column)]))
+			}
+			return writer.Write(row)
+		}
+		return encode, func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	ordered := orderedFields(fields)
+	return func(book *Book) error {
+		if len(fields) > 0 {
+			return encoder.Encode(projectBook(book, ordered))
+		}
+		return encoder.Encode(book)
+	}, func() error { return nil }
+}
+
+func (s *exportSpool) fill(results *sql.Rows, format string, fields []string) error {
+	hash := sha256.New()
+	out := bufio.NewWriter(io.MultiWriter(s.file, hash))
+	encode, flush := exportEncoder(out, format, fields)
+	for results.Next() {
+		var book Book
+		if err := scanBookColumns(results, &book, fields); err != nil {
+			return err
+		}
+		if book.UpdatedAt.After(s.modified) {
+			s.modified = book.UpdatedAt.Time
+		}
+		if err := encode(&book); err != nil {
+			return err
+		}
+	}
+	if err := results.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	s.etag = fmt.Sprintf(`"%x"`, hash.Sum(nil))
+	_, err := s.file.Seek(0, io.SeekStart)
+	return err
+}
+
+func spoolExport(filter bookFilter, format string) (*exportSpool, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	query, args := filter.listQuery(0)
+	results, err := readQueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	file, err := os.CreateTemp("", "books-export-*")
+	if err != nil {
+		return nil, err
+	}
+	spool := &exportSpool{file: file}
+	if err := spool.fill(results, format, filter.Fields); err != nil {
+		log.Println(err.Error())
+		spool.Close()
+		return nil, err
+	}
+	return spool, nil
+}
+
+func handleExportBooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "ndjson"
+		}
+		if format != "ndjson" && format != "csv" {
+			writeError(w, r, http.StatusBadRequest, "format must be ndjson or csv")
+			return
+		}
+		filter, err := parseBookFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !authorizeStatus(w, r) {
+			return
+		}
+		filter.Fields = visibleFields(r, filter.Fields)
+		spool, err := spoolExport(filter, format)
+		if err != nil {
+			writeDBError(w, r, err, "could not export books")
+			return
+		}
+		defer spool.Close()
+		contentType := "application/x-ndjson"
+		if format == "csv" {
+			contentType = "text/csv"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="books.`+format+`"`)
+		w.Header().Set("ETag", spool.etag)
+		http.ServeContent(w, r, "books."+format, spool.modified, spool.file)
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func exportFakeDB(t *testing.T) *fakeDB {
+	return useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(testBook(1, "Dune"), testBook(2, "Emma"), testBook(3, "Ulysses"))
+	})
+}
+
+func TestExportServesByteRange(t *testing.T) {
+	exportFakeDB(t)
+	full := serve(http.HandlerFunc(handleExportBooks), http.MethodGet, "/api/books/export?format=csv", "", nil)
+	if full.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", full.Code, full.Body.String())
+	}
+	body := full.Body.String()
+	w := serve(http.HandlerFunc(handleExportBooks), http.MethodGet, "/api/books/export?format=csv", "", map[string]string{"Range": "bytes=10-29"})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", w.Code)
+	}
+	if want := fmt.Sprintf("bytes 10-29/%d", len(body)); w.Header().Get("Content-Range") != want {
+		t.Errorf("Content-Range = %q, want %q", w.Header().Get("Content-Range"), want)
+	}
+	if w.Body.String() != body[10:30] {
+		t.Errorf("range body = %q, want %q", w.Body.String(), body[10:30])
+	}
+	if full.Header().Get("ETag") != computeETag([]byte(body)) {
+		t.Errorf("ETag = %q, want the hash of the body", full.Header().Get("ETag"))
+	}
+}
+
+func TestBulkLimitRejectsWhenSaturated(t *testing.T) {
+	setForTest(t, &bulkSlots, newDBSlots(2))
+	exportFakeDB(t)
+	export := bulkLimitMiddleware(handleExportBooks)
+	bulkSlots <- struct{}{}
+	bulkSlots <- struct{}{}
+	w := serve(export, http.MethodGet, "/api/books/export", "", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("saturated export: %d %v", w.Code, w.Header())
+	}
+	w = serve(bulkLimitMiddleware(handleImportBooks), http.MethodPost, "/api/books/import", "", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("saturated import: status = %d, want 429", w.Code)
+	}
+	<-bulkSlots
+	if w := serve(export, http.MethodGet, "/api/books/export", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("with a free slot: status = %d", w.Code)
+	}
+	if len(bulkSlots) != 1 {
+		t.Errorf("slots held after the export = %d, want 1", len(bulkSlots))
+	}
+}
+
+func TestExportDefaultsToPublished(t *testing.T) {
+	fake := exportFakeDB(t)
+	serve(http.HandlerFunc(handleExportBooks), http.MethodGet, "/api/books/export", "", nil)
+	list, ok := fake.find("SELECT")
+	if !ok || !strings.Contains(list.query, "status = ?") || list.args[0] != statusPublished {
+		t.Fatalf("export query = %+v", list)
+	}
+}
+
+func TestExportHonoursIfRange(t *testing.T) {
+	exportFakeDB(t)
+	full := serve(http.HandlerFunc(handleExportBooks), http.MethodGet, "/api/books/export", "", nil)
+	etag := full.Header().Get("ETag")
+	if etag == "" || full.Header().Get("Last-Modified") == "" {
+		t.Fatalf("missing validators: %v", full.Header())
+	}
+	w := serve(http.HandlerFunc(handleExportBooks), http.MethodGet, "/api/books/export", "", map[string]string{"Range": "bytes=0-9", "If-Range": etag})
+	if w.Code != http.StatusPartialContent {
+		t.Errorf("matching If-Range: status = %d, want 206", w.Code)
+	}
+	w = serve(http.HandlerFunc(handleExportBooks), http.MethodGet, "/api/books/export", "", map[string]string{"Range": "bytes=0-9", "If-Range": `"stale"`})
+	if w.Code != http.StatusOK || w.Body.String() != full.Body.String() {
+		t.Errorf("stale If-Range: status = %d, want the full 200", w.Code)
+	}
+}
+
+func TestExportIgnoresMaxListRows(t *testing.T) {
+	setForTest(t, &maxListRows, 1)
+	exportFakeDB(t)
+	w := serve(http.HandlerFunc(handleExportBooks), http.MethodGet, "/api/books/export", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResult is what the fake driver answers for a single statement.
+type fakeResult struct {
+	columns  []string
+	rows     [][]driver.Value
+	lastID   int64
+	affected int64
+	err      error
+	// rowsErr is returned by the row stream once rows are exhausted.
+	rowsErr error
+}
+
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+type fakeDB struct {
+	mu         sync.Mutex
+	handler    func(query string, args []driver.Value) fakeResult
+	statements []fakeStatement
+	commits    int
+	rollbacks  int
+	isolations []driver.IsolationLevel
+	opens      int
+}
+
+func (f *fakeDB) answer(query string, named []driver.NamedValue) fakeResult {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	f.mu.Lock()
+	f.statements = append(f.statements, fakeStatement{query: query, args: args})
+	handler := f.handler
+	f.mu.Unlock()
+	if handler == nil || strings.HasPrefix(query, "SAVEPOINT") {
+		return fakeResult{}
+	}
+	return handler(query, args)
+}
+
+func (f *fakeDB) queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queries := make([]string, len(f.statements))
+	for i, statement := range f.statements {
+		queries[i] = statement.query
+	}
+	return queries
+}
+
+func (f *fakeDB) find(substr string) (fakeStatement, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, statement := range f.statements {
+		if strings.Contains(statement.query, substr) {
+			return statement, true
+		}
+	}
+	return fakeStatement{}, false
+}
+
+var fakeDBs sync.Map
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	db, ok := fakeDBs.Load(name)
+	if !ok {
+		return nil, errors.New("fakedb: unknown database " + name)
+	}
+	fake := db.(*fakeDB)
+	fake.mu.Lock()
+	fake.opens++
+	fake.mu.Unlock()
+	return &fakeConn{db: fake}, nil
+}
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{db: c.db}, nil
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.db.mu.Lock()
+	c.db.isolations = append(c.db.isolations, opts.Isolation)
+	c.db.mu.Unlock()
+	return &fakeTx{db: c.db}, nil
+}
+
+func (c *fakeConn) CheckNamedValue(value *driver.NamedValue) error {
+	if v, err := driver.DefaultParameterConverter.ConvertValue(value.Value); err == nil {
+		value.Value = v
+	}
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result := c.db.answer(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return fakeExecResult{lastID: result.lastID, affected: result.affected}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result := c.db.answer(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &fakeRows{columns: result.columns, rows: result.rows, err: result.rowsErr}, nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.db.mu.Lock()
+	tx.db.commits++
+	tx.db.mu.Unlock()
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.db.mu.Lock()
+	tx.db.rollbacks++
+	tx.db.mu.Unlock()
+	return nil
+}
+
+type fakeExecResult struct {
+	lastID   int64
+	affected int64
+}
+
+func (r fakeExecResult) LastInsertId() (int64, error) { return r.lastID, nil }
+func (r fakeExecResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+	err     error
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+func openFakeDB(t *testing.T, name string, handler func(query string, args []driver.Value) fakeResult) (*sql.DB, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{handler: handler}
+	fakeDBs.Store(name, fake)
+	db, err := sql.Open("fakedb", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeDBs.Delete(name)
+	})
+	return db, fake
+}
+
+// useFakeDB points Db at a fake database answered by handler and puts the
+// previous pool back when the test ends.
+func useFakeDB(t *testing.T, handler func(query string, args []driver.Value) fakeResult) *fakeDB {
+	t.Helper()
+	db, fake := openFakeDB(t, t.Name(), handler)
+	previousDB, previousReplicas := Db, readReplicas
+	Db, readReplicas = db, nil
+	t.Cleanup(func() { Db, readReplicas = previousDB, previousReplicas })
+	return fake
+}
+
+var testTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func bookRow(book Book) []driver.Value {
+	return []driver.Value{
+		int64(book.BookID), book.BookName, book.Author, book.Genre, book.Publisher, book.CoverURL,
+		book.Shelf, int64(book.Position), book.Status, book.Language, int64(book.Stock), book.ISBN,
+		book.CreatedAt.Time, book.UpdatedAt.Time,
+	}
+}
+
+func bookRows(books ...Book) fakeResult {
+	result := fakeResult{columns: strings.Split(bookColumns, ", ")}
+	for _, book := range books {
+		result.rows = append(result.rows, bookRow(book))
+	}
+	return result
+}
+
+func testBook(id int, name string) Book {
+	return Book{
+		BookID: id, BookName: name, Author: "Alan Donovan", Genre: "Programming", Publisher: "Addison-Wesley",
+		Status: statusPublished, Language: "en", Stock: 3,
+		CreatedAt: Timestamp{testTime}, UpdatedAt: Timestamp{testTime},
+	}
+}
+
+// bookStore answers single-book lookups from books and acknowledges every
+// other statement, handing out nextID for inserts.
+func bookStore(books map[int]Book, nextID int64) func(string, []driver.Value) fakeResult {
+	return func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT "+bookColumns) && strings.Contains(query, "WHERE bookid = ?"):
+			if book, ok := books[int(args[0].(int64))]; ok {
+				return bookRows(book)
+			}
+			return bookRows()
+		case strings.HasPrefix(query, "INSERT INTO "+booksTable+" "):
+			return fakeResult{lastID: nextID, affected: 1}
+		}
+		return fakeResult{affected: 1}
+	}
+}
+
+func setForTest[T any](t *testing.T, target *T, value T) {
+	t.Helper()
+	previous := *target
+	*target = value
+	t.Cleanup(func() { *target = previous })
+}
+
+func serve(handler http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	for key, value := range header {
+		r.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestMain(m *testing.M) {
+	ready.Store(true)
+	os.Exit(m.Run())
+}
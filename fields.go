@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	emptyFieldsEmpty = "empty"
+	emptyFieldsNull  = "null"
+	emptyFieldsOmit  = "omit"
+)
+
+var (
+	bookColumnNames    = strings.Split(strings.ReplaceAll(bookColumns, " ", ""), ",")
+	emptyFieldsMode    = strings.ToLower(getEnv("EMPTY_FIELDS", emptyFieldsEmpty))
+	optionalBookFields = map[string]bool{"genre": true, "publisher": true, "isbn": true}
+)
+
+func isEmptyOptional(field string, value interface{}) bool {
+	return optionalBookFields[field] && value == ""
+}
+
+func outputValue(field string, value interface{}) interface{} {
+	if emptyFieldsMode != emptyFieldsEmpty && isEmptyOptional(field, value) {
+		return nil
+	}
+	return value
+}
+
+func bookColumnIndex(name string) int {
+	for i, column := range bookColumnNames {
+		if column == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseFields(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var fields []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if bookColumnIndex(field) < 0 {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+func scanBookColumns(scanner rowScanner, book *Book, columns []string) error {
+	if len(columns) == 0 {
+		return scanBook(scanner, book)
+	}
+	all := bookScanDest(book)
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		dest[i] = all[bookColumnIndex(column)]
+	}
+	return scanner.Scan(dest...)
+}
+
+func scanDestValue(dest interface{}) interface{} {
+	if n, ok := dest.(nullableString); ok {
+		return *n.dest
+	}
+	return reflect.ValueOf(dest).Elem().Interface()
+}
+
+type projectedBook struct {
+	fields []string
+	values []interface{}
+}
+
+func (p projectedBook) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	written := 0
+	for i, field := range p.fields {
+		if emptyFieldsMode == emptyFieldsOmit && isEmptyOptional(field, p.values[i]) {
+			continue
+		}
+		if written > 0 {
+			buf.WriteByte(',')
+		}
+		written++
+		key, err := json.Marshal(jsonKey(field))
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshalJSON(outputValue(field, p.values[i]))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(bytes.TrimRight(value, "\n"))
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func orderedFields(fields []string) []string {
+	ordered := append([]string(nil), fields...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return bookColumnIndex(ordered[i]) < bookColumnIndex(ordered[j])
+	})
+	return ordered
+}
+
+func projectBook(book *Book, fields []string) projectedBook {
+	all := bookScanDest(book)
+	row := projectedBook{fields: fields, values: make([]interface{}, len(fields))}
+	for i, field := range fields {
+		row.values[i] = scanDestValue(all[bookColumnIndex(field)])
+	}
+	return row
+}
+
+func projectBooks(books []Book, fields []string) []projectedBook {
+	ordered := orderedFields(fields)
+	projected := make([]projectedBook, 0, len(books))
+	for i := range books {
+		projected = append(projected, projectBook(&books[i], ordered))
+	}
+	return projected
+}
+
+type canonicalBook Book
+
+func (b Book) MarshalJSON() ([]byte, error) {
+	return projectBook(&b, bookColumnNames).MarshalJSON()
+}
+
+type compactList struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+func marshalCompact(books []Book, fields ...string) compactList {
+	columns := bookColumnNames
+	if len(fields) > 0 {
+		columns = orderedFields(fields)
+	}
+	list := compactList{Columns: jsonKeys(columns), Rows: make([][]interface{}, 0, len(books))}
+	for i := range books {
+		all := bookScanDest(&books[i])
+		row := make([]interface{}, len(columns))
+		for j, column := range columns {
+			row[j] = outputValue(column, scanDestValue(all[bookColumnIndex(column)]))
+		}
+		list.Rows = append(list.Rows, row)
+	}
+	return list
+}
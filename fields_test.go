@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// selectedRows answers a SELECT with only the columns the query names.
+func selectedRows(query string, books ...Book) fakeResult {
+	list := strings.TrimPrefix(query[:strings.Index(query, " FROM ")], "SELECT ")
+	result := fakeResult{columns: strings.Split(list, ", ")}
+	for _, book := range books {
+		all := bookRow(book)
+		row := make([]driver.Value, len(result.columns))
+		for i, column := range result.columns {
+			row[i] = all[bookColumnIndex(column)]
+		}
+		result.rows = append(result.rows, row)
+	}
+	return result
+}
+
+func TestFieldsDriveSelectColumns(t *testing.T) {
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return selectedRows(query, testBook(1, "Dune"))
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?fields=author,bookname", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	list, _ := fake.find("SELECT")
+	if !strings.HasPrefix(list.query, "SELECT author, bookname FROM books ") {
+		t.Errorf("query = %q", list.query)
+	}
+	if got := w.Body.String(); got != `[{"bookname":"Dune","author":"Alan Donovan"}]`+"\n" {
+		t.Errorf("body = %s", got)
+	}
+}
+
+func TestFieldsRejectUnknownColumn(t *testing.T) {
+	fake := useFakeDB(t, nil)
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?fields=bookname,password", "", nil)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `unknown field \"password\"`) {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
+
+func TestFieldsFollowDeclarationOrder(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return selectedRows(query, testBook(1, "Dune"), testBook(2, "Emma"))
+	})
+	target := "/api/books?fields=stock,isbn,bookname,bookid,author"
+	first := serve(http.HandlerFunc(handleBooks), http.MethodGet, target, "", nil).Body.String()
+	want := `[{"bookid":1,"bookname":"Dune","author":"Alan Donovan","stock":3,"isbn":""},{"bookid":2,"bookname":"Emma","author":"Alan Donovan","stock":3,"isbn":""}]` + "\n"
+	if first != want {
+		t.Fatalf("body = %s", first)
+	}
+	for i := 0; i < 5; i++ {
+		if got := serve(http.HandlerFunc(handleBooks), http.MethodGet, target, "", nil).Body.String(); got != first {
+			t.Fatalf("call %d = %s, want byte-identical output", i+2, got)
+		}
+	}
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	books := []Book{testBook(1, "Dune"), testBook(2, "Emma")}
+	books[1].ISBN, books[1].Shelf, books[1].Position = "9780134190440", "B2", 4
+	j, err := json.Marshal(marshalCompact(books))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list compactList
+	if err := json.Unmarshal(j, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Rows) != len(books) || strings.Join(list.Columns, ",") != strings.Join(jsonKeys(bookColumnNames), ",") {
+		t.Fatalf("list = %s", j)
+	}
+	for i, row := range list.Rows {
+		record := make(map[string]interface{}, len(row))
+		for j, column := range list.Columns {
+			record[column] = row[j]
+		}
+		encoded, _ := json.Marshal(record)
+		var book Book
+		if err := json.Unmarshal(encoded, &book); err != nil {
+			t.Fatal(err)
+		}
+		if book != books[i] {
+			t.Errorf("row %d = %+v, want %+v", i, book, books[i])
+		}
+	}
+}
+
+func TestCompactListFormat(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return selectedRows(query, testBook(1, "Dune"))
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?format=compact&fields=author,bookname", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != `{"columns":["bookname","author"],"rows":[["Dune","Alan Donovan"]]}`+"\n" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?format=xml", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status = %d", w.Code)
+	}
+}
+
+func TestEmptyFieldsModes(t *testing.T) {
+	book := testBook(1, "Dune")
+	book.Publisher = ""
+	cases := []struct {
+		mode, full, projected string
+	}{
+		{emptyFieldsEmpty, `"publisher":"",`, `{"bookname":"Dune","publisher":""}`},
+		{emptyFieldsNull, `"publisher":null,`, `{"bookname":"Dune","publisher":null}`},
+		{emptyFieldsOmit, `"author":"Alan Donovan","genre":"Programming","cover_url"`, `{"bookname":"Dune"}`},
+	}
+	for _, c := range cases {
+		t.Run(c.mode, func(t *testing.T) {
+			setForTest(t, &emptyFieldsMode, c.mode)
+			useFakeDB(t, bookStore(map[int]Book{1: book}, 0))
+			full := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil).Body.String()
+			if !strings.Contains(full, c.full) {
+				t.Errorf("book = %s", full)
+			}
+			if c.mode == emptyFieldsOmit && strings.Contains(full, "publisher") {
+				t.Errorf("book = %s", full)
+			}
+			useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+				return selectedRows(query, book)
+			})
+			projected := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?fields=bookname,publisher", "", nil).Body.String()
+			if projected != "["+c.projected+"]\n" {
+				t.Errorf("projected = %s", projected)
+			}
+		})
+	}
+}
+
+func TestSetupDBRejectsInvalidEmptyFields(t *testing.T) {
+	setForTest(t, &emptyFieldsMode, "blank")
+	if err := SetupDB(); err == nil || !strings.Contains(err.Error(), "EMPTY_FIELDS") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var caseSensitiveFilters = getEnvBool("FILTERS_CASE_SENSITIVE", false)
+
+var maxQueryFilters = getEnvInt("MAX_QUERY_FILTERS", 8)
+
+var defaultSort = getEnv("DEFAULT_SORT", "bookid")
+
+var maxFilterLength = getEnvInt("MAX_FILTER_LENGTH", 200)
+
+var sortColumns = []string{"bookid", "bookname", "author", "genre", "publisher", "position", "updated_at"}
+
+// repeatableFilterParams may be sent more than once; the values are
+// combined into an IN filter. Repeating any of singleValueParams is
+// rejected with 400 because there is no sensible way to merge them.
+var repeatableFilterParams = []string{"shelf", "language", "author", "genre"}
+
+var singleValueParams = []string{"status", "sort", "modified_since", "fields", "tags", "tag_mode"}
+
+type bookFilter struct {
+	Shelf         []string
+	Status        string
+	Language      []string
+	Author        []string
+	Genre         []string
+	ModifiedSince time.Time
+	Tags          []string
+	TagMode       string
+	Sort          string
+	Fields        []string
+}
+
+func parseBookFilter(query url.Values) (bookFilter, error) {
+	for _, param := range singleValueParams {
+		if len(query[param]) > 1 {
+			return bookFilter{}, fmt.Errorf("%s may only be given once", param)
+		}
+	}
+	for _, param := range repeatableFilterParams {
+		for _, value := range query[param] {
+			if err := checkFilterLength(param, value); err != nil {
+				return bookFilter{}, err
+			}
+		}
+	}
+	filter := bookFilter{
+		Shelf:    queryValues(query, "shelf"),
+		Language: queryValues(query, "language"),
+		Author:   queryValues(query, "author"),
+		Genre:    queryValues(query, "genre"),
+		Sort:     query.Get("sort"),
+	}
+	for i, language := range filter.Language {
+		filter.Language[i] = strings.ToLower(language)
+		if !isLanguageCode(filter.Language[i]) {
+			return filter, fmt.Errorf("language must be an ISO 639-1 code")
+		}
+	}
+	fields, err := parseFields(query.Get("fields"))
+	if err != nil {
+		return filter, err
+	}
+	filter.Fields = fields
+	if value := query.Get("tags"); value != "" {
+		filter.Tags, filter.TagMode, err = parseTagFilter(value, query.Get("tag_mode"))
+		if err != nil {
+			return filter, err
+		}
+	}
+	switch status := query.Get("status"); status {
+	case "":
+		filter.Status = statusPublished
+	case "all":
+	case statusDraft, statusPublished:
+		filter.Status = status
+	default:
+		return filter, fmt.Errorf("unsupported status %q", status)
+	}
+	if value := query.Get("modified_since"); value != "" {
+		modifiedSince, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("modified_since must be an RFC3339 timestamp")
+		}
+		filter.ModifiedSince = modifiedSince
+		if filter.Sort == "" {
+			filter.Sort = "updated_at"
+		}
+	}
+	if n := filter.termCount(); maxQueryFilters > 0 && n > maxQueryFilters {
+		return filter, fmt.Errorf("at most %d filter values may be combined, got %d", maxQueryFilters, n)
+	}
+	if filter.Sort != "" && !isSortColumn(strings.TrimPrefix(filter.Sort, "-")) {
+		return filter, fmt.Errorf("unsupported sort %q", filter.Sort)
+	}
+	return filter, nil
+}
+
+func checkFilterLength(param, value string) error {
+	if maxFilterLength > 0 && utf8.RuneCountInString(value) > maxFilterLength {
+		return fmt.Errorf("%s must be at most %d characters", param, maxFilterLength)
+	}
+	return nil
+}
+
+func queryValues(query url.Values, param string) []string {
+	var values []string
+	for _, value := range query[param] {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func isSortColumn(column string) bool {
+	for _, c := range sortColumns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+func inCondition(column, placeholder string, n int) string {
+	if n == 1 {
+		return fmt.Sprintf("%s = %s", column, placeholder)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat(placeholder+",", n), ",")
+	return fmt.Sprintf("%s IN (%s)", column, placeholders)
+}
+
+func textIn(column string, n int) string {
+	if caseSensitiveFilters {
+		return inCondition("BINARY "+column, "?", n)
+	}
+	return inCondition(fmt.Sprintf("LOWER(%s)", column), "LOWER(?)", n)
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+func queryParamDescription(param string) string {
+	for _, p := range repeatableFilterParams {
+		if p == param {
+			return "repeatable; values are combined with OR"
+		}
+	}
+	for _, p := range singleValueParams {
+		if p == param {
+			return "single value; repeating it returns 400"
+		}
+	}
+	return ""
+}
+
+func (f bookFilter) termCount() int {
+	n := len(f.Shelf) + len(f.Language) + len(f.Author) + len(f.Genre) + len(f.Tags)
+	if f.Status != "" && f.Status != statusPublished {
+		n++
+	}
+	if !f.ModifiedSince.IsZero() {
+		n++
+	}
+	return n
+}
+
+func (f bookFilter) conditions() ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if len(f.Shelf) > 0 {
+		conditions = append(conditions, textIn("shelf", len(f.Shelf)))
+		args = append(args, stringArgs(f.Shelf)...)
+	}
+	if f.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, f.Status)
+	}
+	if len(f.Language) > 0 {
+		conditions = append(conditions, inCondition("language", "?", len(f.Language)))
+		args = append(args, stringArgs(f.Language)...)
+	}
+	if len(f.Author) > 0 {
+		conditions = append(conditions, textIn("author", len(f.Author)))
+		args = append(args, stringArgs(f.Author)...)
+	}
+	if len(f.Genre) > 0 {
+		conditions = append(conditions, textIn("genre", len(f.Genre)))
+		args = append(args, stringArgs(f.Genre)...)
+	}
+	if len(f.Tags) > 0 {
+		condition, tagArgs := tagCondition(f.Tags, f.TagMode)
+		conditions = append(conditions, condition)
+		args = append(args, tagArgs...)
+	}
+	if !f.ModifiedSince.IsZero() {
+		conditions = append(conditions, "updated_at >= ?")
+		args = append(args, f.ModifiedSince.UTC())
+	}
+	return conditions, args
+}
+
+func (f bookFilter) whereClause() (string, []interface{}) {
+	conditions, args := f.conditions()
+	conditions = append([]string{"deleted_at IS NULL"}, conditions...)
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (f bookFilter) orderClause() string {
+	sort := f.Sort
+	if sort == "" {
+		sort = defaultSort
+	}
+	column, direction := strings.TrimPrefix(sort, "-"), ""
+	if column != sort {
+		direction = " DESC"
+	}
+	if column == "bookid" {
+		return fmt.Sprintf(" ORDER BY bookid%s", direction)
+	}
+	return fmt.Sprintf(" ORDER BY %s%s, bookid", column, direction)
+}
+
+func (f bookFilter) listQuery(maxRows int) (string, []interface{}) {
+	where, args := f.whereClause()
+	columns := bookColumns
+	if len(f.Fields) > 0 {
+		columns = strings.Join(f.Fields, ", ")
+	}
+	query := fmt.Sprintf(`SELECT %s FROM %s%s%s`, columns, booksTable, where, f.orderClause())
+	if maxRows > 0 {
+		query += fmt.Sprintf(" LIMIT %d", maxRows+1)
+	}
+	return query, args
+}
+
+func (f bookFilter) idsQuery() (string, []interface{}) {
+	where, args := f.whereClause()
+	return fmt.Sprintf(`SELECT bookid FROM %s%s%s`, booksTable, where, f.orderClause()), args
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func modifiedBooksDB(t *testing.T) *fakeDB {
+	old, recent := testBook(1, "Old"), testBook(2, "Recent")
+	old.UpdatedAt = Timestamp{testTime.Add(-48 * time.Hour)}
+	recent.UpdatedAt = Timestamp{testTime.Add(time.Hour)}
+	return useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		var rows []Book
+		for _, book := range []Book{old, recent} {
+			if !strings.Contains(query, "updated_at >= ?") || !book.UpdatedAt.Before(args[len(args)-1].(time.Time)) {
+				rows = append(rows, book)
+			}
+		}
+		return bookRows(rows...)
+	})
+}
+
+func TestGetBooksModifiedSince(t *testing.T) {
+	fake := modifiedBooksDB(t)
+	books, err := getBooksModifiedSince(testTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 || books[0].BookName != "Recent" {
+		t.Fatalf("books = %+v", books)
+	}
+	list, _ := fake.find("SELECT")
+	if !strings.Contains(list.query, "ORDER BY updated_at, bookid") {
+		t.Errorf("query = %q", list.query)
+	}
+}
+
+func TestListModifiedSince(t *testing.T) {
+	modifiedBooksDB(t)
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?modified_since=2024-03-01T12:00:00Z", "", nil)
+	var books []Book
+	if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(books) != 1 || books[0].BookName != "Recent" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestListModifiedSinceRejectsBadTimestamp(t *testing.T) {
+	fake := modifiedBooksDB(t)
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?modified_since=yesterday", "", nil)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "RFC3339") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
+
+// authorFilterDB stores one mixed-case author and compares the author filter
+// the way MySQL would for the condition the query uses.
+func authorFilterDB(t *testing.T) *fakeDB {
+	book := testBook(1, "Foundation")
+	book.Author = "Asimov"
+	return useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		author := args[len(args)-1]
+		switch {
+		case strings.Contains(query, "LOWER(author) = LOWER(?)") && strings.EqualFold(author.(string), book.Author),
+			strings.Contains(query, "BINARY author = ?") && author == book.Author:
+			return bookRows(book)
+		}
+		return bookRows()
+	})
+}
+
+func TestAuthorFilterIgnoresCase(t *testing.T) {
+	fake := authorFilterDB(t)
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?author=asimov", "", nil)
+	var books []Book
+	if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 || books[0].Author != "Asimov" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if list, _ := fake.find("SELECT"); list.args[len(list.args)-1] != "asimov" {
+		t.Errorf("args = %v, want the value still bound as a parameter", list.args)
+	}
+}
+
+func TestCaseSensitiveFilters(t *testing.T) {
+	setForTest(t, &caseSensitiveFilters, true)
+	authorFilterDB(t)
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?author=asimov", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "[]\n" {
+		t.Errorf("lowercase: got %d %s", w.Code, w.Body.String())
+	}
+	w = serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?author=Asimov", "", nil)
+	if !strings.Contains(w.Body.String(), `"author":"Asimov"`) {
+		t.Errorf("exact case: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRepeatedAuthorBecomesIN(t *testing.T) {
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult { return bookRows() })
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?author=Asimov&author=Herbert", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	list, _ := fake.find("SELECT")
+	if !strings.Contains(list.query, "LOWER(author) IN (LOWER(?),LOWER(?))") {
+		t.Errorf("query = %q", list.query)
+	}
+	if n := len(list.args); n < 2 || list.args[n-2] != "Asimov" || list.args[n-1] != "Herbert" {
+		t.Errorf("args = %v", list.args)
+	}
+}
+
+func TestRepeatedSingleValueParamIs400(t *testing.T) {
+	fake := useFakeDB(t, nil)
+	for _, query := range []string{"sort=bookname&sort=author", "status=draft&status=published"} {
+		w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?"+query, "", nil)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "may only be given once") {
+			t.Errorf("%s: got %d %s", query, w.Code, w.Body.String())
+		}
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
+
+func TestRepeatableParamsAreDocumented(t *testing.T) {
+	w := serve(http.HandlerFunc(handleBooks), http.MethodOptions, "/api/books", "", nil)
+	var caps capabilities
+	if err := json.Unmarshal(w.Body.Bytes(), &caps); err != nil {
+		t.Fatal(err)
+	}
+	if !contains(caps.Repeatable, "author") || !contains(caps.SingleValue, "sort") || contains(caps.Repeatable, "sort") {
+		t.Errorf("capabilities = %+v", caps)
+	}
+	if got := queryParamDescription("author"); !strings.Contains(got, "repeatable") {
+		t.Errorf("author description = %q", got)
+	}
+	if got := queryParamDescription("sort"); !strings.Contains(got, "400") {
+		t.Errorf("sort description = %q", got)
+	}
+}
+
+func TestOverLengthFilterIs400(t *testing.T) {
+	setForTest(t, &maxFilterLength, 10)
+	fake := useFakeDB(t, nil)
+	long := strings.Repeat("é", 11)
+	for target, handler := range map[string]http.HandlerFunc{
+		"/api/books?author=Asimov&author=" + long: handleBooks,
+		"/api/search?q=" + long:                   handleSearch,
+		"/api/books?tags=" + long:                 handleBooks,
+	} {
+		w := serve(handler, http.MethodGet, target, "", nil)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "must be at most 10 characters") {
+			t.Errorf("%s: got %d %s", target, w.Code, w.Body.String())
+		}
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?author="+strings.Repeat("é", 10), "", nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("value at the limit: status = %d", w.Code)
+	}
+}
+
+func TestListOrderIsStableAcrossCalls(t *testing.T) {
+	books := []Book{testBook(3, "Ulysses"), testBook(1, "Dune"), testBook(2, "Emma")}
+	calls := 0
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		calls++
+		rotated := append(books[calls%len(books):], books[:calls%len(books)]...)
+		if strings.Contains(query, " ORDER BY bookid") {
+			return bookRows(testBook(1, "Dune"), testBook(2, "Emma"), testBook(3, "Ulysses"))
+		}
+		return bookRows(rotated...)
+	})
+	var first string
+	for i := 0; i < 3; i++ {
+		w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", nil)
+		if i == 0 {
+			first = w.Body.String()
+		} else if w.Body.String() != first {
+			t.Fatalf("call %d returned a different order", i+1)
+		}
+	}
+	if list, _ := fake.find("SELECT"); !strings.Contains(list.query, " ORDER BY bookid LIMIT") {
+		t.Errorf("query = %q", list.query)
+	}
+}
+
+func TestDefaultSortIsConfigurable(t *testing.T) {
+	setForTest(t, &defaultSort, "-bookname")
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult { return bookRows() })
+	serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", nil)
+	if list, _ := fake.find("SELECT"); !strings.Contains(list.query, " ORDER BY bookname DESC, bookid") {
+		t.Errorf("query = %q, want bookid as the tie-breaker", list.query)
+	}
+}
+
+func TestTooManyFiltersIs400(t *testing.T) {
+	setForTest(t, &maxQueryFilters, 3)
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult { return bookRows() })
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?author=A&author=B&genre=C&tags=d", "", nil)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "at most 3 filter values may be combined, got 4") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+	w = serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?author=A&author=B&genre=C", "", nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("at the cap: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var genreDelimiter = getEnv("GENRE_DELIMITER", "/")
+
+type genreNode struct {
+	Name     string       `json:"name"`
+	Path     string       `json:"path"`
+	Count    int          `json:"count"`
+	Children []*genreNode `json:"children"`
+}
+
+func buildGenreTree(counts map[string]int, delimiter string) []*genreNode {
+	root := &genreNode{Children: make([]*genreNode, 0)}
+	index := make(map[string]*genreNode)
+	for genre, count := range counts {
+		node := root
+		var path []string
+		parts := []string{genre}
+		if delimiter != "" {
+			parts = strings.Split(genre, delimiter)
+		}
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			path = append(path, part)
+			key := strings.Join(path, delimiter)
+			child, ok := index[key]
+			if !ok {
+				child = &genreNode{Name: part, Path: key, Children: make([]*genreNode, 0)}
+				index[key] = child
+				node.Children = append(node.Children, child)
+			}
+			child.Count += count
+			node = child
+		}
+	}
+	sortGenreNodes(root.Children)
+	return root.Children
+}
+
+func sortGenreNodes(nodes []*genreNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	for _, node := range nodes {
+		sortGenreNodes(node.Children)
+	}
+}
+
+func countByGenre() (map[string]int, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	results, err := readQueryContext(ctx, fmt.Sprintf(`SELECT COALESCE(genre, ''), COUNT(*) FROM %s WHERE deleted_at IS NULL AND status = ? GROUP BY genre`, booksTable), statusPublished)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	counts := make(map[string]int)
+	for results.Next() {
+		var genre string
+		var count int
+		if err := results.Scan(&genre, &count); err != nil {
+			return nil, err
+		}
+		counts[genre] += count
+	}
+	return counts, results.Err()
+}
+
+func handleGenreTree(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		counts, err := countByGenre()
+		if err != nil {
+			writeDBError(w, r, err, "could not count books by genre")
+			return
+		}
+		writeJSONWithETag(w, r, buildGenreTree(counts, genreDelimiter))
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"testing"
+)
+
+func TestGenreTreeNestsAndCounts(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{columns: []string{"genre", "count"}, rows: [][]driver.Value{
+			{"Fiction/Sci-Fi", int64(3)},
+			{"Fiction/Sci-Fi/Space Opera", int64(2)},
+			{"Fiction", int64(1)},
+			{"Fiction / Mystery", int64(4)},
+			{"Programming", int64(5)},
+		}}
+	})
+	w := serve(http.HandlerFunc(handleGenreTree), http.MethodGet, "/api/books/genre-tree", "", nil)
+	want := `[{"name":"Fiction","path":"Fiction","count":10,"children":[` +
+		`{"name":"Mystery","path":"Fiction/Mystery","count":4,"children":[]},` +
+		`{"name":"Sci-Fi","path":"Fiction/Sci-Fi","count":5,"children":[` +
+		`{"name":"Space Opera","path":"Fiction/Sci-Fi/Space Opera","count":2,"children":[]}]}]},` +
+		`{"name":"Programming","path":"Programming","count":5,"children":[]}]` + "\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGenreTreeWithoutDelimiterIsFlat(t *testing.T) {
+	tree := buildGenreTree(map[string]int{"Fiction/Sci-Fi": 2, "Fiction": 1}, "")
+	if len(tree) != 2 || tree[0].Name != "Fiction" || tree[1].Name != "Fiction/Sci-Fi" || len(tree[1].Children) != 0 {
+		t.Errorf("tree = %+v %+v", tree[0], tree[1])
+	}
+}
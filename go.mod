@@ -2,4 +2,4 @@ module github.com/Worrameth/go-project-api-forB2Dcourse
 
 go 1.21.3
 
-require github.com/go-sql-driver/mysql v1.7.1 // indirect
+require github.com/go-sql-driver/mysql v1.7.1
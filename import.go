@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxImportSize = 32 << 20
+
+var importColumns = strings.Split(strings.ReplaceAll(bookInsertColumns, " ", ""), ",")
+
+type importRowError struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+type importItemResult struct {
+	Row    int      `json:"row"`
+	Status int      `json:"status"`
+	ID     int      `json:"id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type importMultiStatus struct {
+	Imported int                `json:"imported"`
+	Failed   int                `json:"failed"`
+	Results  []importItemResult `json:"results"`
+}
+
+type importReport struct {
+	Imported int              `json:"imported"`
+	IDs      []int            `json:"ids"`
+	Errors   []importRowError `json:"errors"`
+}
+
+func isImportColumn(name string) bool {
+	for _, column := range importColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+func setBookColumn(book *Book, column, value string) error {
+	switch column {
+	case "bookid", "position", "stock":
+		n := 0
+		if value = strings.TrimSpace(value); value != "" {
+			var err error
+			n, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s must be an integer", column)
+			}
+		}
+		switch column {
+		case "bookid":
+			book.BookID = n
+		case "position":
+			book.Position = n
+		default:
+			book.Stock = n
+		}
+	case "bookname":
+		book.BookName = value
+	case "author":
+		book.Author = value
+	case "genre":
+		book.Genre = value
+	case "publisher":
+		book.Publisher = value
+	case "cover_url":
+		book.CoverURL = value
+	case "shelf":
+		book.Shelf = value
+	case "status":
+		book.Status = value
+	case "isbn":
+		book.ISBN = value
+	case "language":
+		book.Language = strings.ToLower(strings.TrimSpace(value))
+	default:
+		return fmt.Errorf("unknown column %q", column)
+	}
+	return nil
+}
+
+func parseImportCSV(body io.Reader, header bool) ([]Book, []int, []importRowError, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	columns := importColumns
+	if header {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("could not read header row: %w", err)
+		}
+		columns = make([]string, len(record))
+		for i, name := range record {
+			columns[i] = strings.ToLower(strings.TrimSpace(name))
+			if !isImportColumn(columns[i]) {
+				return nil, nil, nil, fmt.Errorf("unknown column %q", name)
+			}
+		}
+	}
+	books := make([]Book, 0)
+	bookRows := make([]int, 0)
+	rowErrors := make([]importRowError, 0)
+	row := 0
+	if header {
+		row = 1
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(record) != len(columns) {
+			rowErrors = append(rowErrors, importRowError{Row: row, Errors: []string{
+				fmt.Sprintf("expected %d fields, got %d", len(columns), len(record)),
+			}})
+			continue
+		}
+		var book Book
+		var errs []string
+		for i, column := range columns {
+			if err := setBookColumn(&book, column, record[i]); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		applyBookDefaults(&book)
+		errs = append(errs, validateBook(book)...)
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, importRowError{Row: row, Errors: errs})
+			continue
+		}
+		books = append(books, book)
+		bookRows = append(bookRows, row)
+	}
+	return books, bookRows, rowErrors, nil
+}
+
+func importEach(books []Book, bookRows []int, rowErrors []importRowError, actor string) importMultiStatus {
+	report := importMultiStatus{Results: make([]importItemResult, 0, len(books)+len(rowErrors))}
+	for _, rowError := range rowErrors {
+		report.Results = append(report.Results, importItemResult{Row: rowError.Row, Status: validationStatus(), Errors: rowError.Errors})
+	}
+	for i, book := range books {
+		id, err := insertBook(book, actor)
+		if err != nil {
+			message := "could not insert book"
+			if devMode {
+				message += ": " + err.Error()
+			}
+			report.Results = append(report.Results, importItemResult{Row: bookRows[i], Status: http.StatusInternalServerError, Errors: []string{message}})
+			continue
+		}
+		report.Results = append(report.Results, importItemResult{Row: bookRows[i], Status: http.StatusCreated, ID: id})
+	}
+	sort.Slice(report.Results, func(i, j int) bool {
+		return report.Results[i].Row < report.Results[j].Row
+	})
+	for _, result := range report.Results {
+		if result.Status == http.StatusCreated {
+			report.Imported++
+		} else {
+			report.Failed++
+		}
+	}
+	return report
+}
+
+func handleImportBooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			log.Print(err)
+			writeError(w, r, http.StatusBadRequest, "a multipart CSV upload in field \"file\" is required")
+			return
+		}
+		defer file.Close()
+		books, bookRows, rowErrors, err := parseImportCSV(file, r.URL.Query().Get("header") != "false")
+		if err != nil {
+			log.Print(err)
+			writeError(w, r, http.StatusBadRequest, "invalid CSV: "+err.Error())
+			return
+		}
+		if r.URL.Query().Get("atomic") == "false" {
+			writeJSON(w, r, http.StatusMultiStatus, importEach(books, bookRows, rowErrors, requestActor(r)))
+			return
+		}
+		ids := make([]int, 0)
+		if len(books) > 0 {
+			ids, err = insertBooks(books, requestActor(r))
+			if err != nil {
+				writeDBError(w, r, err, "could not import books")
+				return
+			}
+		}
+		writeJSON(w, r, http.StatusOK, importReport{Imported: len(ids), IDs: ids, Errors: rowErrors})
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
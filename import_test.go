@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// insertStore plays the books table for the insert paths: it assigns ids to
+// inserted rows and returns them to the (bookname, author) read-back.
+type insertStore struct {
+	nextID  int64
+	books   []Book
+	inserts int
+	fail    func(book Book) error
+}
+
+func (s *insertStore) handle(query string, args []driver.Value) fakeResult {
+	width := strings.Count(bookInsertColumns, ",") + 1
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO "+booksTable+" ("):
+		s.inserts++
+		var rows []Book
+		for i := 0; i+width <= len(args); i += width {
+			book := Book{BookName: args[i+1].(string), Author: args[i+2].(string), Genre: args[i+3].(string), Status: args[i+8].(string)}
+			if s.fail != nil {
+				if err := s.fail(book); err != nil {
+					return fakeResult{err: err}
+				}
+			}
+			rows = append(rows, book)
+		}
+		for i := range rows {
+			s.nextID++
+			rows[i].BookID = int(s.nextID)
+		}
+		s.books = append(s.books, rows...)
+		return fakeResult{lastID: s.nextID, affected: int64(len(rows))}
+	case strings.Contains(query, "(bookname, author) IN"):
+		var rows []Book
+		for i := 0; i+1 < len(args); i += 2 {
+			for _, book := range s.books {
+				if book.BookName == args[i] && book.Author == args[i+1] {
+					rows = append(rows, book)
+				}
+			}
+		}
+		return bookRows(rows...)
+	case strings.HasPrefix(query, "SELECT "+bookColumns) && strings.Contains(query, "WHERE bookid = ?"):
+		for _, book := range s.books {
+			if int64(book.BookID) == args[0] {
+				return bookRows(book)
+			}
+		}
+		return bookRows()
+	}
+	return fakeResult{affected: 1}
+}
+
+func uploadCSV(t *testing.T, target, csv string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "books.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(csv))
+	form.Close()
+	return serve(http.HandlerFunc(handleImportBooks), http.MethodPost, target, body.String(), map[string]string{"Content-Type": form.FormDataContentType()})
+}
+
+func TestImportCleanCSV(t *testing.T) {
+	store := &insertStore{nextID: 10}
+	fake := useFakeDB(t, store.handle)
+	csv := "bookname,author,genre\nDune,Frank Herbert,Sci-Fi\nEmma,Jane Austen,Romance\n"
+	w := uploadCSV(t, "/api/books/import", csv)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var report importReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 2 || len(report.IDs) != 2 || report.IDs[0] != 11 || report.IDs[1] != 12 || len(report.Errors) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	if store.books[1].Genre != "Romance" {
+		t.Errorf("header mapping lost the genre: %+v", store.books)
+	}
+	if fake.commits != 1 {
+		t.Errorf("commits = %d, want one transaction", fake.commits)
+	}
+}
+
+func TestImportWithoutUniqueTitlesTakesInsertIDs(t *testing.T) {
+	store := &insertStore{nextID: 10, books: []Book{{BookID: 5, BookName: "Dune", Author: "Frank Herbert"}}}
+	fake := useFakeDB(t, store.handle)
+	w := uploadCSV(t, "/api/books/import", "bookname,author\nDune,Frank Herbert\nDune,Frank Herbert\n")
+	var report importReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if len(report.IDs) != 2 || report.IDs[0] != 11 || report.IDs[1] != 12 {
+		t.Fatalf("ids = %v, want the two new rows", report.IDs)
+	}
+	if _, ok := fake.find("(bookname, author) IN"); ok || store.inserts != 2 {
+		t.Errorf("inserts = %d, want one per row without a title lookup", store.inserts)
+	}
+}
+
+func TestImportReportsInvalidRow(t *testing.T) {
+	store := &insertStore{}
+	useFakeDB(t, store.handle)
+	csv := "bookname,author,stock\nDune,Frank Herbert,2\n,Nobody,x\nEmma,Jane Austen,1\n"
+	w := uploadCSV(t, "/api/books/import", csv)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var report importReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 2 || len(report.Errors) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if rowError := report.Errors[0]; rowError.Row != 3 || len(rowError.Errors) != 2 {
+		t.Errorf("row error = %+v, want row 3 with stock and bookname errors", rowError)
+	}
+	if len(store.books) != 2 {
+		t.Errorf("inserted %d books, want the two valid rows", len(store.books))
+	}
+}
+
+func TestImportRejectsUnknownHeader(t *testing.T) {
+	useFakeDB(t, (&insertStore{}).handle)
+	w := uploadCSV(t, "/api/books/import", "title,author\nDune,Frank Herbert\n")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestImportRequiresFile(t *testing.T) {
+	w := serve(http.HandlerFunc(handleImportBooks), http.MethodPost, "/api/books/import", "bookname\n", map[string]string{"Content-Type": "text/csv"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestImportNonAtomicReportsEachRow(t *testing.T) {
+	store := &insertStore{nextID: 20, fail: func(book Book) error {
+		if book.BookName == "Emma" {
+			return errors.New("deadlock")
+		}
+		return nil
+	}}
+	useFakeDB(t, store.handle)
+	csv := "bookname,author,stock\nDune,Frank Herbert,2\n,Nobody,x\nEmma,Jane Austen,1\n"
+	w := uploadCSV(t, "/api/books/import?atomic=false", csv)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var report importMultiStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 || report.Failed != 2 || len(report.Results) != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+	want := []importItemResult{
+		{Row: 2, Status: http.StatusCreated, ID: 21},
+		{Row: 3, Status: validationStatus()},
+		{Row: 4, Status: http.StatusInternalServerError},
+	}
+	for i, result := range report.Results {
+		if result.Row != want[i].Row || result.Status != want[i].Status || result.ID != want[i].ID {
+			t.Errorf("result %d = %+v, want %+v", i, result, want[i])
+		}
+	}
+	if len(store.books) != 1 || store.books[0].BookName != "Dune" {
+		t.Errorf("stored = %+v, want only the valid row", store.books)
+	}
+}
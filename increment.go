@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const incrementOperator = "$inc"
+
+var incrementFloors = map[string]int{
+	"stock": 0,
+}
+
+var errBelowFloor = errors.New("increment would take the field below its minimum")
+
+func parseIncrements(body map[string]map[string]int) (map[string]int, error) {
+	if len(body) == 0 {
+		return nil, fmt.Errorf("at least one field increment is required")
+	}
+	increments := make(map[string]int, len(body))
+	for field, operation := range body {
+		if _, ok := incrementFloors[field]; !ok {
+			return nil, fmt.Errorf("field %q does not support %s", field, incrementOperator)
+		}
+		delta, ok := operation[incrementOperator]
+		if !ok || len(operation) != 1 {
+			return nil, fmt.Errorf("field %q must be of the form {%q: n}", field, incrementOperator)
+		}
+		increments[field] = delta
+	}
+	return increments, nil
+}
+
+func bookFieldValue(book *Book, field string) int {
+	switch field {
+	case "stock":
+		return book.Stock
+	}
+	return 0
+}
+
+func incrementBook(bookID int, increments map[string]int, actor string) (*Book, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	fields := make([]string, 0, len(increments))
+	for field := range increments {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var newBook *Book
+	err = retryWrites(ctx, func() error {
+		tx, err := beginTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer rollbackTx(tx)
+		oldBook, err := getBookTx(ctx, tx, bookID)
+		if err != nil || oldBook == nil {
+			newBook = nil
+			return err
+		}
+		assignments := make([]string, 0, len(fields))
+		args := make([]interface{}, 0, len(fields)+1)
+		for _, field := range fields {
+			if bookFieldValue(oldBook, field)+increments[field] < incrementFloors[field] {
+				return fmt.Errorf("%w: %s must be at least %d", errBelowFloor, field, incrementFloors[field])
+			}
+			assignments = append(assignments, fmt.Sprintf("%s = %s + ?", field, field))
+			args = append(args, increments[field])
+		}
+		query := fmt.Sprintf(`UPDATE %s SET %s WHERE bookid = ? AND deleted_at IS NULL`, booksTable, strings.Join(assignments, ", "))
+		if _, err := txExecContext(ctx, tx, query, append(args, bookID)...); err != nil {
+			return err
+		}
+		newBook, err = getBookTx(ctx, tx, bookID)
+		if err != nil {
+			return err
+		}
+		if err := insertAuditTx(ctx, tx, bookID, auditUpdate, actor, oldBook, newBook); err != nil {
+			return err
+		}
+		return commitTx(tx)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	if newBook != nil {
+		publishBookChange(auditUpdate, bookID)
+	}
+	return newBook, nil
+}
+
+func handleBookIncrement(w http.ResponseWriter, r *http.Request, bookID int) {
+	var body map[string]map[string]int
+	if err := decodeJSON(r.Body, &body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid increment payload: "+err.Error())
+		return
+	}
+	increments, err := parseIncrements(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	book, err := incrementBook(bookID, increments, requestActor(r))
+	if errors.Is(err, errBelowFloor) {
+		writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeDBError(w, r, err, "could not update book")
+		return
+	}
+	if book == nil {
+		writeError(w, r, http.StatusNotFound, "book not found")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, visibleBook(r, book))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var jsonHeader = map[string]string{"Content-Type": "application/json"}
+
+// stockStore applies relative stock updates to the stored book.
+func stockStore(books map[int]Book) func(string, []driver.Value) fakeResult {
+	store := bookStore(books, 0)
+	return func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "UPDATE books SET stock = stock + ?") {
+			book := books[int(args[1].(int64))]
+			book.Stock += int(args[0].(int64))
+			books[book.BookID] = book
+			return fakeResult{affected: 1}
+		}
+		return store(query, args)
+	}
+}
+
+func TestIncrementAndDecrementStock(t *testing.T) {
+	books := map[int]Book{1: testBook(1, "Dune")}
+	fake := useFakeDB(t, stockStore(books))
+	for _, step := range []struct {
+		body string
+		want int
+	}{
+		{`{"stock":{"$inc":2}}`, 5},
+		{`{"stock":{"$inc":-5}}`, 0},
+	} {
+		w := serve(http.HandlerFunc(handleBook), http.MethodPatch, "/api/books/1", step.body, jsonHeader)
+		var book Book
+		if err := json.Unmarshal(w.Body.Bytes(), &book); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", step.body, w.Code, w.Body.String())
+		}
+		if book.Stock != step.want || books[1].Stock != step.want {
+			t.Errorf("%s: stock = %d, want %d", step.body, book.Stock, step.want)
+		}
+	}
+	if fake.commits != 2 {
+		t.Errorf("commits = %d", fake.commits)
+	}
+}
+
+func TestDecrementBelowFloorIsConflict(t *testing.T) {
+	books := map[int]Book{1: testBook(1, "Dune")}
+	fake := useFakeDB(t, stockStore(books))
+	w := serve(http.HandlerFunc(handleBook), http.MethodPatch, "/api/books/1", `{"stock":{"$inc":-4}}`, jsonHeader)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "stock must be at least 0") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if _, ok := fake.find("UPDATE books SET stock"); ok || books[1].Stock != 3 {
+		t.Errorf("stock changed to %d", books[1].Stock)
+	}
+}
+
+func TestIncrementRejectsNonNumericField(t *testing.T) {
+	useFakeDB(t, nil)
+	w := serve(http.HandlerFunc(handleBook), http.MethodPatch, "/api/books/1", `{"bookname":{"$inc":1}}`, jsonHeader)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `does not support $inc`) {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
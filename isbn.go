@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	isbn10 = "isbn10"
+	isbn13 = "isbn13"
+)
+
+type isbnValidation struct {
+	Valid bool   `json:"valid"`
+	Type  string `json:"type"`
+	ISBN  string `json:"isbn"`
+}
+
+func normalizeISBN(value string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(value)))
+}
+
+func validateISBN(value string) (string, string, error) {
+	isbn := normalizeISBN(value)
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, c := range isbn {
+			digit := int(c - '0')
+			if c == 'X' && i == 9 {
+				digit = 10
+			} else if c < '0' || c > '9' {
+				return "", "", errors.New("isbn10 may only contain digits and a trailing X")
+			}
+			sum += (10 - i) * digit
+		}
+		if sum%11 != 0 {
+			return "", "", errors.New("isbn10 check digit does not match")
+		}
+		return isbn, isbn10, nil
+	case 13:
+		sum := 0
+		for i, c := range isbn {
+			if c < '0' || c > '9' {
+				return "", "", errors.New("isbn13 may only contain digits")
+			}
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += weight * int(c-'0')
+		}
+		if sum%10 != 0 {
+			return "", "", errors.New("isbn13 check digit does not match")
+		}
+		return isbn, isbn13, nil
+	}
+	return "", "", errors.New("isbn must have 10 or 13 digits")
+}
+
+func handleValidateISBN(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		value := r.URL.Query().Get("isbn")
+		if value == "" {
+			writeError(w, r, http.StatusBadRequest, "isbn is required")
+			return
+		}
+		isbn, kind, err := validateISBN(value)
+		if err != nil {
+			writeError(w, r, validationStatus(), err.Error())
+			return
+		}
+		writeJSON(w, r, http.StatusOK, isbnValidation{Valid: true, Type: kind, ISBN: isbn})
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func getBookByISBN(isbn string, drafts bool) (*Book, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	where, args := "isbn = ? AND deleted_at IS NULL", []interface{}{normalizeISBN(isbn)}
+	if !drafts {
+		where += " AND status = ?"
+		args = append(args, statusPublished)
+	}
+	row := readQueryRowContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY bookid LIMIT 1`, bookColumns, booksTable, where), args...)
+	book := &Book{}
+	err = scanBook(row, book)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return book, nil
+}
+
+func handleBookByISBN(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		segments := strings.SplitN(r.URL.Path, fmt.Sprintf("%s/isbn/", bookPath), 2)
+		value := segments[len(segments)-1]
+		if len(segments) != 2 || value == "" || strings.Contains(value, "/") {
+			writeError(w, r, http.StatusNotFound, "book not found")
+			return
+		}
+		isbn, _, err := validateISBN(value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		book, err := getBookByISBN(isbn, isAuthenticated(r))
+		if err != nil {
+			writeDBError(w, r, err, "could not get book")
+			return
+		}
+		if book == nil {
+			writeError(w, r, http.StatusNotFound, "book not found")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, visibleBook(r, book))
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
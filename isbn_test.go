@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateISBNEndpoint(t *testing.T) {
+	fake := useFakeDB(t, nil)
+	for _, c := range []struct {
+		isbn string
+		code int
+		body string
+	}{
+		{"978-0-13-419044-0", http.StatusOK, `{"valid":true,"type":"isbn13","isbn":"9780134190440"}`},
+		{"0-13-419044-0", http.StatusOK, `{"valid":true,"type":"isbn10","isbn":"0134190440"}`},
+		{"080442957x", http.StatusOK, `{"valid":true,"type":"isbn10","isbn":"080442957X"}`},
+		{"9780134190441", validationStatus(), "check digit does not match"},
+		{"12345", validationStatus(), "10 or 13 digits"},
+		{"", http.StatusBadRequest, "isbn is required"},
+	} {
+		w := serve(http.HandlerFunc(handleValidateISBN), http.MethodGet, "/api/isbn/validate?isbn="+c.isbn, "", nil)
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.body) {
+			t.Errorf("%q: got %d %s", c.isbn, w.Code, w.Body.String())
+		}
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v, want no database access", fake.queries())
+	}
+}
+
+func routesMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, route := range bookRoutes() {
+		mux.Handle("/api"+route.pattern, route.handler)
+	}
+	return mux
+}
+
+func TestGetBookByISBN(t *testing.T) {
+	book := testBook(4, "The Go Programming Language")
+	book.ISBN = "9780134190440"
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.Contains(query, "WHERE isbn = ?") && args[0] == book.ISBN {
+			return bookRows(book)
+		}
+		return bookRows()
+	})
+	w := serve(routesMux(), http.MethodGet, "/api/books/isbn/978-0-13-419044-0", "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"bookid":4`) {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if lookup, _ := fake.find("WHERE isbn = ?"); lookup.args[0] != "9780134190440" {
+		t.Errorf("args = %v, want the normalized isbn", lookup.args)
+	}
+
+	w = serve(routesMux(), http.MethodGet, "/api/books/isbn/0-306-40615-2", "", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown isbn: status = %d", w.Code)
+	}
+	w = serve(routesMux(), http.MethodGet, "/api/books/isbn/12345", "", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("malformed isbn: status = %d", w.Code)
+	}
+}
+
+func TestISBNPathIsNotABookID(t *testing.T) {
+	fake := useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	if w := serve(routesMux(), http.MethodGet, "/api/books/1", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("numeric id: status = %d", w.Code)
+	}
+	serve(routesMux(), http.MethodGet, "/api/books/isbn/9780134190440", "", nil)
+	if _, ok := fake.find("WHERE isbn = ?"); !ok {
+		t.Errorf("queries = %v, want the isbn lookup", fake.queries())
+	}
+}
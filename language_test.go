@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCreateBookWithLanguage(t *testing.T) {
+	fake := useFakeDB(t, bookStore(nil, 1))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert","language":"EN"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	insert, _ := fake.find("INSERT INTO books ")
+	if insert.args[9] != "en" {
+		t.Errorf("language = %v, want it normalized to en", insert.args[9])
+	}
+}
+
+func TestCreateBookRejectsUnknownLanguage(t *testing.T) {
+	useFakeDB(t, bookStore(nil, 1))
+	for _, language := range []string{"xx", "eng", "e"} {
+		w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert","language":"`+language+`"}`, nil)
+		if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "ISO 639-1") {
+			t.Errorf("language %q: got %d %s", language, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestListFiltersByLanguage(t *testing.T) {
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(testBook(1, "Dune"))
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?language=en&language=fr", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	list, _ := fake.find("SELECT")
+	if !strings.Contains(list.query, "language IN (?,?)") || list.args[1] != "en" || list.args[2] != "fr" {
+		t.Errorf("query = %q args = %v", list.query, list.args)
+	}
+	if w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?language=zz", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid language filter: status = %d", w.Code)
+	}
+}
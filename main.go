@@ -1,37 +1,227 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 type Book struct {
-	BookID    int    `json:"bookid"`
-	BookName  string `json:"bookname"`
-	Author    string `json:"author"`
-	Genre     string `json:"genre"`
-	Publisher string `json:"publisher"`
+	BookID    int       `json:"bookid"`
+	BookName  string    `json:"bookname"`
+	Author    string    `json:"author"`
+	Genre     string    `json:"genre"`
+	Publisher string    `json:"publisher"`
+	CoverURL  string    `json:"cover_url"`
+	Shelf     string    `json:"shelf"`
+	Position  int       `json:"position"`
+	Status    string    `json:"status"`
+	Language  string    `json:"language"`
+	Stock     int       `json:"stock"`
+	ISBN      string    `json:"isbn"`
+	CreatedAt Timestamp `json:"created_at"`
+	UpdatedAt Timestamp `json:"updated_at"`
+}
+
+const (
+	statusDraft     = "draft"
+	statusPublished = "published"
+)
+
+const bookInsertColumns = "bookid, bookname, author, genre, publisher, cover_url, shelf, position, status, language, stock, isbn"
+
+const bookColumns = bookInsertColumns + ", created_at, updated_at"
+
+func (b *Book) UnmarshalJSON(data []byte) error {
+	type bookAlias Book
+	aux := struct {
+		BookID json.RawMessage `json:"bookid"`
+		*bookAlias
+	}{bookAlias: (*bookAlias)(b)}
+	if jsonNaming != namingLower {
+		var err error
+		if data, err = renameBookKeys(data); err != nil {
+			return err
+		}
+	}
+	if err := decodeJSON(bytes.NewReader(data), &aux); err != nil {
+		return err
+	}
+	if len(aux.BookID) == 0 || string(aux.BookID) == "null" {
+		return nil
+	}
+	bookID, err := parseFlexibleInt(aux.BookID)
+	if err != nil {
+		return fmt.Errorf("bookid: %w", err)
+	}
+	b.BookID = bookID
+	return nil
+}
+
+func parseFlexibleInt(raw json.RawMessage) (int, error) {
+	var n int
+	if raw[0] != '"' {
+		err := json.Unmarshal(raw, &n)
+		return n, err
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an integer", value)
+	}
+	return n, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type nullableString struct {
+	dest *string
+}
+
+func (n nullableString) Scan(value interface{}) error {
+	var s sql.NullString
+	if err := s.Scan(value); err != nil {
+		return err
+	}
+	if !s.Valid && strictNullScan {
+		return errors.New("unexpected NULL in a string column")
+	}
+	*n.dest = s.String
+	return nil
+}
+
+func bookScanDest(book *Book) []interface{} {
+	return []interface{}{
+		&book.BookID,
+		&book.BookName,
+		nullableString{&book.Author},
+		nullableString{&book.Genre},
+		nullableString{&book.Publisher},
+		&book.CoverURL,
+		&book.Shelf,
+		&book.Position,
+		&book.Status,
+		&book.Language,
+		&book.Stock,
+		&book.ISBN,
+		&book.CreatedAt,
+		&book.UpdatedAt,
+	}
+}
+
+func bookInsertArgs(book Book) []interface{} {
+	return []interface{}{
+		book.BookID,
+		book.BookName,
+		book.Author,
+		book.Genre,
+		book.Publisher,
+		book.CoverURL,
+		book.Shelf,
+		book.Position,
+		book.Status,
+		book.Language,
+		book.Stock,
+		book.ISBN,
+	}
+}
+
+func insertBookQuery() string {
+	return insertBooksQuery(1)
+}
+
+func scanBook(scanner rowScanner, book *Book) error {
+	return scanner.Scan(bookScanDest(book)...)
 }
 
 const bookPath = "books"
 
 var Db *sql.DB
 
+var dbDriver = "mysql"
+
+const (
+	dbMaxOpenConns = 10
+	dbMaxIdleConns = 10
+)
+
+var maxListRows = getEnvInt("MAX_LIST_ROWS", 10000)
+
+var errTooManyRows = errors.New("result set exceeds the maximum number of rows")
+
+var strictNullScan = getEnvBool("STRICT_NULL_SCAN", false)
+
+var warmConnections = getEnvInt("DB_WARM_CONNECTIONS", 0)
+
+var booksTable = getEnv("BOOKS_TABLE", "books")
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
 const basePath = "/api"
 
-func getBookList() ([]Book, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+var handlerTimeout = getEnvDuration("HTTP_HANDLER_TIMEOUT", 10*time.Second)
+
+var validationUnprocessable = getEnvBool("VALIDATION_UNPROCESSABLE", true)
+
+var copyNameSuffix = getEnv("COPY_NAME_SUFFIX", " (Copy)")
+
+var emptyListNoContent = getEnvBool("EMPTY_LIST_NO_CONTENT", false)
+
+var confirmInserts = getEnvBool("CONFIRM_INSERTS", false)
+
+var maxBookID = getEnvInt("MAX_BOOK_ID", math.MaxInt32)
+
+var (
+	defaultGenre     = getEnv("DEFAULT_GENRE", "Unknown")
+	defaultPublisher = getEnv("DEFAULT_PUBLISHER", "Unknown")
+)
+
+type partialListError struct {
+	books []Book
+	err   error
+}
+
+func (e *partialListError) Error() string {
+	return fmt.Sprintf("book list truncated after %d rows: %v", len(e.books), e.err)
+}
+
+func (e *partialListError) Unwrap() error {
+	return e.err
+}
+
+func getBookList(filter bookFilter) ([]Book, error) {
+	return queryBookList(filter, maxListRows)
+}
+
+func queryBookList(filter bookFilter, maxRows int) ([]Book, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
 	defer cancel()
-	results, err := Db.QueryContext(ctx, `SELECT * FROM books`)
+	query, args := filter.listQuery(maxRows)
+	results, err := readQueryContext(ctx, query, args...)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
@@ -39,31 +229,104 @@ func getBookList() ([]Book, error) {
 	defer results.Close()
 	books := make([]Book, 0)
 	for results.Next() {
+		if maxRows > 0 && len(books) >= maxRows {
+			return nil, errTooManyRows
+		}
 		var book Book
-		results.Scan(
-			&book.BookID,
-			&book.BookName,
-			&book.Author,
-			&book.Genre,
-			&book.Publisher)
+		if err := scanBookColumns(results, &book, filter.Fields); err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
 		books = append(books, book)
 	}
+	if err := results.Err(); err != nil {
+		log.Println(err.Error())
+		if len(books) > 0 {
+			return nil, &partialListError{books: books, err: err}
+		}
+		return nil, err
+	}
 	return books, nil
 }
 
+func getBooksModifiedSince(t time.Time) ([]Book, error) {
+	return getBookList(bookFilter{Status: statusPublished, ModifiedSince: t, Sort: "updated_at"})
+}
+
+func getBookIDs(filter bookFilter) ([]int, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	query, args := filter.idsQuery()
+	results, err := readQueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	ids := make([]int, 0)
+	for results.Next() {
+		var id int
+		if err := results.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, results.Err()
+}
+
+func getBooksGroupedByGenre(limitPerGenre int) (map[string][]Book, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	results, err := readQueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE deleted_at IS NULL AND status = ? ORDER BY genre, bookid`, bookColumns, booksTable), statusPublished)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	groups := make(map[string][]Book)
+	for results.Next() {
+		var book Book
+		err := scanBook(results, &book)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+		if limitPerGenre > 0 && len(groups[book.Genre]) >= limitPerGenre {
+			continue
+		}
+		groups[book.Genre] = append(groups[book.Genre], book)
+	}
+	if err := results.Err(); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return groups, nil
+}
+
 func getBook(bookID int) (*Book, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	return fetchBook(readQueryRowContext, bookID)
+}
+
+func getBookFromPrimary(bookID int) (*Book, error) {
+	return fetchBook(queryRowContext, bookID)
+}
+
+func fetchBook(queryRow func(context.Context, string, ...interface{}) rowScanner, bookID int) (*Book, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
 	defer cancel()
-	row := Db.QueryRowContext(ctx, `SELECT * FROM books WHERE bookid = ?`, bookID)
+	row := queryRow(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE bookid = ? AND deleted_at IS NULL`, bookColumns, booksTable), bookID)
 
 	book := &Book{}
-	err := row.Scan(
-		&book.BookID,
-		&book.BookName,
-		&book.Author,
-		&book.Genre,
-		&book.Publisher,
-	)
+	err = scanBook(row, book)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -74,152 +337,852 @@ func getBook(bookID int) (*Book, error) {
 	return book, nil
 }
 
-func removeBook(bookID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	_, err := Db.ExecContext(ctx, `DELETE FROM books WHERE bookid = ?`, bookID)
+func removeBook(bookID int, actor string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE bookid = ?`, booksTable)
+	if softDelete {
+		query = fmt.Sprintf(`UPDATE %s SET deleted_at = NOW() WHERE bookid = ? AND deleted_at IS NULL`, booksTable)
+	}
+	_, err := auditedExec(actor, auditDelete, bookID, query, bookID)
+	return err
+}
+
+func insertBook(book Book, actor string) (int, error) {
+	return auditedExec(actor, auditInsert, 0, insertBookQuery(), bookInsertArgs(book)...)
+}
+
+const insertBatchRows = 1000
+
+func insertBooksQuery(rows int) string {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?,", strings.Count(bookInsertColumns, ",")+1), ",") + ")"
+	return fmt.Sprintf(`INSERT INTO %s (%s) VALUES %s`, booksTable, bookInsertColumns, strings.TrimSuffix(strings.Repeat(placeholders+", ", rows), ", "))
+}
+
+func bookTitleKey(bookName, author string) string {
+	return strings.ToLower(bookName) + "\x00" + strings.ToLower(author)
+}
+
+func insertBooksTx(ctx context.Context, tx *sql.Tx, books []Book, actor string) ([]int, error) {
+	ids := make([]int, 0, len(books))
+	for start := 0; start < len(books); start += insertBatchRows {
+		end := start + insertBatchRows
+		if end > len(books) {
+			end = len(books)
+		}
+		chunk, err := insertBookChunkTx(ctx, tx, books[start:end], actor)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+		ids = append(ids, chunk...)
+	}
+	return ids, nil
+}
+
+// insertBookRowsTx inserts one row per statement and takes each id from
+// LastInsertId, for tables where a title may match more than one book.
+func insertBookRowsTx(ctx context.Context, tx *sql.Tx, books []Book, actor string) ([]int, error) {
+	ids := make([]int, len(books))
+	for i, book := range books {
+		id, err := auditedExecTx(ctx, tx, actor, auditInsert, 0, insertBookQuery(), bookInsertArgs(book)...)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// insertBookChunkTx inserts books in one statement and finds their ids by
+// title, which is only unambiguous under the UNIQUE_TITLES index.
+func insertBookChunkTx(ctx context.Context, tx *sql.Tx, books []Book, actor string) ([]int, error) {
+	if !uniqueTitles {
+		return insertBookRowsTx(ctx, tx, books, actor)
+	}
+	args := make([]interface{}, 0, len(books)*(strings.Count(bookInsertColumns, ",")+1))
+	keys := make([]string, 0, len(books))
+	keyArgs := make([]interface{}, 0, 2*len(books))
+	for _, book := range books {
+		args = append(args, bookInsertArgs(book)...)
+		keys = append(keys, "(?, ?)")
+		keyArgs = append(keyArgs, book.BookName, book.Author)
+	}
+	if _, err := txExecContext(ctx, tx, insertBooksQuery(len(books)), args...); err != nil {
+		return nil, err
+	}
+	inserted, err := getBooksTx(ctx, tx, fmt.Sprintf("(bookname, author) IN (%s)", strings.Join(keys, ", ")), keyArgs...)
 	if err != nil {
-		log.Println(err.Error())
-		return err
+		return nil, err
 	}
-	return nil
+	byTitle := make(map[string]*Book, len(inserted))
+	for i := range inserted {
+		byTitle[bookTitleKey(inserted[i].BookName, inserted[i].Author)] = &inserted[i]
+	}
+	ids := make([]int, len(books))
+	rows := make([]auditRow, len(books))
+	for i, book := range books {
+		newBook, ok := byTitle[bookTitleKey(book.BookName, book.Author)]
+		if !ok {
+			return nil, fmt.Errorf("inserted book %q by %q not found", book.BookName, book.Author)
+		}
+		ids[i] = newBook.BookID
+		rows[i] = auditRow{bookID: newBook.BookID, newBook: newBook}
+	}
+	if err := insertAuditRowsTx(ctx, tx, auditInsert, actor, rows); err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
 
-func insertBook(book Book) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func insertBooks(books []Book, actor string) ([]int, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
 	defer cancel()
-	result, err := Db.ExecContext(ctx, `INSERT INTO books (bookid, bookname, author, genre, publisher) VALUES (?,?,?,?,?)`, book.BookID, book.BookName, book.Author, book.Genre, book.Publisher)
+	var ids []int
+	err = retryWrites(ctx, func() error {
+		tx, err := beginTx(ctx)
+		if err != nil {
+			log.Println(err.Error())
+			return err
+		}
+		defer rollbackTx(tx)
+		ids, err = insertBooksTx(ctx, tx, books, actor)
+		if err != nil {
+			return err
+		}
+		if err := commitTx(tx); err != nil {
+			log.Println(err.Error())
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		log.Println(err.Error())
-		return 0, err
+		return nil, err
+	}
+	for _, id := range ids {
+		publishBookChange(auditInsert, id)
+	}
+	return ids, nil
+}
+
+func updateBookStatement(book Book) (string, []interface{}) {
+	return fmt.Sprintf(`UPDATE %s SET bookname = ?, author = ?, genre = ?, publisher = ?, cover_url = ?, shelf = ?, position = ?, status = ?, language = ?, stock = ?, isbn = ? WHERE bookid = ? AND deleted_at IS NULL`, booksTable),
+		[]interface{}{book.BookName, book.Author, book.Genre, book.Publisher, book.CoverURL, book.Shelf, book.Position, book.Status, book.Language, book.Stock, book.ISBN, book.BookID}
+}
+
+func updateBookLocation(bookID int, shelf string, position int, actor string) error {
+	_, err := auditedExec(actor, auditUpdate, bookID, fmt.Sprintf(`UPDATE %s SET shelf = ?, position = ? WHERE bookid = ? AND deleted_at IS NULL`, booksTable), shelf, position, bookID)
+	return err
+}
+
+func setBookStatus(bookID int, status string, actor string) error {
+	_, err := auditedExec(actor, auditUpdate, bookID, fmt.Sprintf(`UPDATE %s SET status = ? WHERE bookid = ? AND deleted_at IS NULL`, booksTable), status, bookID)
+	return err
+}
+
+type capabilities struct {
+	Methods     []string `json:"methods"`
+	Filters     []string `json:"filters"`
+	Repeatable  []string `json:"repeatable"`
+	SingleValue []string `json:"single_value"`
+	Sort        []string `json:"sort"`
+}
+
+var booksCapabilities = capabilities{
+	Methods:     []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodOptions},
+	Filters:     []string{"shelf", "status", "language", "author", "genre", "tags", "modified_since"},
+	Repeatable:  repeatableFilterParams,
+	SingleValue: singleValueParams,
+	Sort:        sortColumns,
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+type validationResult struct {
+	Index  int      `json:"index"`
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+func applyBookDefaults(book *Book) {
+	if strings.TrimSpace(book.Genre) == "" {
+		book.Genre = defaultGenre
+	}
+	if strings.TrimSpace(book.Publisher) == "" {
+		book.Publisher = defaultPublisher
+	}
+	if book.Status == "" {
+		book.Status = statusDraft
 	}
-	insertID, err := result.LastInsertId()
+	book.Language = strings.ToLower(strings.TrimSpace(book.Language))
+	book.ISBN = normalizeISBN(book.ISBN)
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
 	if err != nil {
-		log.Println(err.Error())
-		return 0, err
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validateLocation(shelf string, position int) []string {
+	var errs []string
+	if len(shelf) > 64 {
+		errs = append(errs, "shelf must be at most 64 characters")
 	}
-	return int(insertID), nil
+	if position < 0 {
+		errs = append(errs, "position must not be negative")
+	}
+	return errs
+}
+
+func validationStatus() int {
+	if validationUnprocessable {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadRequest
+}
+
+func validateBook(book Book) []string {
+	var errs []string
+	if book.BookID < 0 {
+		errs = append(errs, "bookid must not be negative")
+	} else if book.BookID > maxBookID {
+		errs = append(errs, fmt.Sprintf("bookid out of range, must be at most %d", maxBookID))
+	}
+	if strings.TrimSpace(book.BookName) == "" {
+		errs = append(errs, "bookname is required")
+	}
+	if strings.TrimSpace(book.Author) == "" {
+		errs = append(errs, "author is required")
+	}
+	if book.CoverURL != "" && !isHTTPURL(book.CoverURL) {
+		errs = append(errs, "cover_url must be an absolute http or https URL")
+	}
+	errs = append(errs, validateLocation(book.Shelf, book.Position)...)
+	errs = append(errs, validatePublisher(book.Publisher)...)
+	if book.Language != "" && !isLanguageCode(book.Language) {
+		errs = append(errs, fmt.Sprintf("language %q is not an ISO 639-1 code", book.Language))
+	}
+	if book.Status != "" && book.Status != statusDraft && book.Status != statusPublished {
+		errs = append(errs, "status must be draft or published")
+	}
+	if book.Stock < 0 {
+		errs = append(errs, "stock must not be negative")
+	}
+	if book.ISBN != "" {
+		if _, _, err := validateISBN(book.ISBN); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return errs
+}
+
+func copyBook(sourceID int, actor string) (*Book, error) {
+	source, err := getBook(sourceID)
+	if err != nil || source == nil {
+		return nil, err
+	}
+	copied := *source
+	copied.BookID = 0
+	copied.BookName += copyNameSuffix
+	copied.Status = statusDraft
+	newID, err := insertBook(copied, actor)
+	if err != nil {
+		return nil, err
+	}
+	book, err := getBook(newID)
+	if err != nil {
+		return nil, err
+	}
+	if book == nil {
+		return nil, fmt.Errorf("copied book %d not found after insert", newID)
+	}
+	return book, nil
 }
 
 func handleBooks(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		bookList, err := getBookList()
+		filter, err := parseBookFilter(r.URL.Query())
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
-		j, err := json.Marshal(bookList)
-		if err != nil {
-			log.Fatal(err)
+		if !authorizeStatus(w, r) {
+			return
+		}
+		filter.Fields = visibleFields(r, filter.Fields)
+		if format := r.URL.Query().Get("format"); format != "" && format != "compact" {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("unsupported format %q", format))
+			return
+		}
+		callback := r.URL.Query().Get("callback")
+		if callback != "" && !callbackPattern.MatchString(callback) {
+			writeError(w, r, http.StatusBadRequest, "invalid callback name")
+			return
+		}
+		if r.URL.Query().Get("ids_only") == "true" {
+			ids, err := getBookIDs(filter)
+			if err != nil {
+				writeDBError(w, r, err, "could not list book ids")
+				return
+			}
+			if len(ids) == 0 && emptyListNoContent {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			writeJSONWithETag(w, r, ids)
+			return
+		}
+		bookList, fromCache, err := getBookListWithFallback(filter)
+		var partial *partialListError
+		if r.URL.Query().Get("allow_partial") == "true" && errors.As(err, &partial) {
+			bookList, err = partial.books, nil
+			w.Header().Add("Warning", fmt.Sprintf("299 - %q", fmt.Sprintf("partial results: read failed after %d books", len(bookList))))
 		}
-		_, err = w.Write(j)
 		if err != nil {
-			log.Fatal(err)
+			writeDBError(w, r, err, "could not list books")
+			return
+		}
+		if fromCache {
+			w.Header().Set("X-Served-From-Cache", "true")
 		}
+		if len(bookList) == 0 && emptyListNoContent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		var body interface{} = bookList
+		if r.URL.Query().Get("format") == "compact" {
+			body = marshalCompact(bookList, filter.Fields...)
+		} else if len(filter.Fields) > 0 {
+			body = projectBooks(bookList, filter.Fields)
+		}
+		if callback != "" {
+			writeJSONP(w, r, callback, body)
+			return
+		}
+		writeJSONWithETag(w, r, body)
 	case http.MethodPost:
 		var book Book
-		err := json.NewDecoder(r.Body).Decode(&book)
+		err := decodeJSON(r.Body, &book)
 		if err != nil {
 			log.Print(err)
-			w.WriteHeader(http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, "invalid book payload: "+err.Error())
+			return
+		}
+		applyBookDefaults(&book)
+		if errs := validateBook(book); len(errs) > 0 {
+			log.Print(strings.Join(errs, "; "))
+			writeError(w, r, validationStatus(), strings.Join(errs, "; "))
 			return
 		}
-		_, err = insertBook(book)
+		warnUnknownPublisher(w, book.Publisher)
+		if writeQueueEnabled {
+			write, err := bookWriteQueue.enqueue(book, requestActor(r))
+			if errors.Is(err, errWriteQueueClosed) {
+				write503(w, r, time.Second, "server is shutting down, retry later", nil)
+				return
+			}
+			if err != nil {
+				write503(w, r, time.Second, "write queue is full, retry later", nil)
+				return
+			}
+			w.Header().Set("Location", fmt.Sprintf("%s/queued/%s", r.URL.Path, write.ID))
+			writeJSON(w, r, http.StatusAccepted, write)
+			return
+		}
+		bookID, err := insertBook(book, requestActor(r))
 		if err != nil {
-			log.Print(err)
-			w.WriteHeader(http.StatusBadRequest)
+			writeDBError(w, r, err, "could not create book")
+			return
+		}
+		location := fmt.Sprintf("%s/%d", strings.TrimSuffix(r.URL.Path, "/"), bookID)
+		preference := applyPreferReturn(w, r)
+		if preference == preferMinimal {
+			w.Header().Set("Location", location)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if confirmInserts || preference == preferRepresentation {
+			created, err := getBookFromPrimary(bookID)
+			if err == nil && created == nil {
+				err = fmt.Errorf("book %d not found after insert", bookID)
+			}
+			if err != nil {
+				writeErrorDetail(w, r, http.StatusInternalServerError, "could not confirm created book", err)
+				return
+			}
+			w.Header().Set("Location", location)
+			writeJSON(w, r, http.StatusCreated, visibleBook(r, created))
 			return
 		}
+		w.Header().Set("Location", location)
 		w.WriteHeader(http.StatusCreated)
 		//w.Write([]byte(fmt.Sprintf(`{"bookid":%d}`, BookID)))
+	case http.MethodPatch:
+		requireAuth(handleBulkPatchBooks)(w, r)
 	case http.MethodOptions:
-		return
+		if isPreflight(r) {
+			return
+		}
+		w.Header().Set("Allow", strings.Join(booksCapabilities.Methods, ", "))
+		writeJSON(w, r, http.StatusOK, booksCapabilities)
 	default:
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
+func bookIDInRange(bookID int) bool {
+	return bookID > 0 && bookID <= maxBookID
+}
+
+func parseBookID(value string) (int, error) {
+	bookID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, err
+	}
+	if err != nil || bookID > int64(maxBookID) {
+		return 0, fmt.Errorf("id out of range, must be at most %d", maxBookID)
+	}
+	if bookID <= 0 {
+		return 0, fmt.Errorf("id must be a positive integer")
+	}
+	return int(bookID), nil
+}
+
 func handleBook(w http.ResponseWriter, r *http.Request) {
 	urlPathSegments := strings.Split(r.URL.Path, fmt.Sprintf("%s/", bookPath))
 	if len(urlPathSegments[1:]) > 1 {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "invalid book path")
 		return
 	}
-	bookID, err := strconv.Atoi(urlPathSegments[len(urlPathSegments)-1])
-	if err != nil {
+	subPathSegments := strings.Split(urlPathSegments[len(urlPathSegments)-1], "/")
+	if len(subPathSegments) > 2 {
+		writeError(w, r, http.StatusBadRequest, "invalid book path")
+		return
+	}
+	bookID, err := parseBookID(subPathSegments[0])
+	if errors.Is(err, strconv.ErrSyntax) {
 		log.Print(err)
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, "book not found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(subPathSegments) == 2 {
+		switch subPathSegments[1] {
+		case "copy":
+			handleBookCopy(w, r, bookID)
+		case "location":
+			handleBookLocation(w, r, bookID)
+		case "publish":
+			handleBookPublish(w, r, bookID)
+		case "history":
+			handleBookHistory(w, r, bookID)
+		case "tags":
+			handleBookTags(w, r, bookID)
+		default:
+			writeError(w, r, http.StatusNotFound, "not found")
+		}
 		return
 	}
 	switch r.Method {
 	case http.MethodGet:
 		book, err := getBook(bookID)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeDBError(w, r, err, "could not get book")
+			return
+		}
+		if book == nil || (book.Status == statusDraft && !isAuthenticated(r)) {
+			writeError(w, r, http.StatusNotFound, "book not found")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, visibleBook(r, book))
+	case http.MethodPut:
+		handleBookPut(w, r, bookID)
+	case http.MethodPatch:
+		handleBookPatch(w, r, bookID)
+	case http.MethodDelete:
+		err := removeBook(bookID, requestActor(r))
+		if err != nil {
+			log.Println(err)
+			writeDBError(w, r, err, "could not delete book")
+			return
+		}
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func handleBookCopy(w http.ResponseWriter, r *http.Request, bookID int) {
+	switch r.Method {
+	case http.MethodPost:
+		book, err := copyBook(bookID, requestActor(r))
+		if err != nil {
+			writeDBError(w, r, err, "could not copy book")
 			return
 		}
 		if book == nil {
-			w.WriteHeader(http.StatusNotFound)
+			writeError(w, r, http.StatusNotFound, "book not found")
 			return
 		}
-		j, err := json.Marshal(book)
+		writeJSON(w, r, http.StatusCreated, visibleBook(r, book))
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+type bookLocation struct {
+	Shelf    string `json:"shelf"`
+	Position int    `json:"position"`
+}
+
+func handleBookLocation(w http.ResponseWriter, r *http.Request, bookID int) {
+	switch r.Method {
+	case http.MethodPut:
+		var location bookLocation
+		err := decodeJSON(r.Body, &location)
 		if err != nil {
 			log.Print(err)
-			w.WriteHeader(http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, "invalid location payload: "+err.Error())
 			return
 		}
-		_, err = w.Write(j)
+		if errs := validateLocation(location.Shelf, location.Position); len(errs) > 0 {
+			writeError(w, r, validationStatus(), strings.Join(errs, "; "))
+			return
+		}
+		book, err := getBook(bookID)
 		if err != nil {
-			log.Fatal(err)
+			writeDBError(w, r, err, "could not get book")
+			return
 		}
-	case http.MethodDelete:
-		err := removeBook(bookID)
+		if book == nil {
+			writeError(w, r, http.StatusNotFound, "book not found")
+			return
+		}
+		err = updateBookLocation(bookID, location.Shelf, location.Position, requestActor(r))
 		if err != nil {
-			log.Println(err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeDBError(w, r, err, "could not update book location")
 			return
 		}
+		book.Shelf = location.Shelf
+		book.Position = location.Position
+		writeJSON(w, r, http.StatusOK, visibleBook(r, book))
+	case http.MethodOptions:
+		return
 	default:
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
+func handleBookPublish(w http.ResponseWriter, r *http.Request, bookID int) {
+	switch r.Method {
+	case http.MethodPost:
+		book, err := getBook(bookID)
+		if err != nil {
+			writeDBError(w, r, err, "could not get book")
+			return
+		}
+		if book == nil {
+			writeError(w, r, http.StatusNotFound, "book not found")
+			return
+		}
+		err = setBookStatus(bookID, statusPublished, requestActor(r))
+		if err != nil {
+			writeDBError(w, r, err, "could not publish book")
+			return
+		}
+		book.Status = statusPublished
+		writeJSON(w, r, http.StatusOK, visibleBook(r, book))
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func handleValidateBooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var books []Book
+		err := decodeJSON(r.Body, &books)
+		if err != nil {
+			log.Print(err)
+			writeError(w, r, http.StatusBadRequest, "invalid books payload: "+err.Error())
+			return
+		}
+		results := make([]validationResult, 0, len(books))
+		for i, book := range books {
+			applyBookDefaults(&book)
+			errs := validateBook(book)
+			results = append(results, validationResult{Index: i, Valid: len(errs) == 0, Errors: errs})
+		}
+		writeJSON(w, r, http.StatusOK, results)
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func handleBooksByGenre(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limitPerGenre := 0
+		if value := r.URL.Query().Get("limit_per_genre"); value != "" {
+			var err error
+			limitPerGenre, err = strconv.Atoi(value)
+			if err != nil || limitPerGenre < 0 {
+				writeError(w, r, http.StatusBadRequest, "limit_per_genre must be a non-negative integer")
+				return
+			}
+		}
+		groups, err := getBooksGroupedByGenre(limitPerGenre)
+		if err != nil {
+			writeDBError(w, r, err, "could not list books")
+			return
+		}
+		visible := make(map[string]interface{}, len(groups))
+		for genre, books := range groups {
+			visible[genre] = visibleBooks(r, books)
+		}
+		writeJSON(w, r, http.StatusOK, visible)
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+var corsEnabled = getEnvBool("CORS_ENABLED", true)
+
 func corsMiddleware(handler http.Handler) http.Handler {
+	if !corsEnabled {
+		return handler
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Access-Control-Allow-Origin", "*")
-		w.Header().Add("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Origin, X-Requested-With")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, PATCH, OPTIONS, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Origin, X-Requested-With, Range, If-None-Match, Authorization, Accept-Version, Content-Encoding, Prefer")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Warning, X-API-Schema-Version, Location, Preference-Applied, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
 		handler.ServeHTTP(w, r)
 
 	})
 }
 
+type timeoutResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w timeoutResponseWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if status == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+		setRetryAfter(w, time.Second)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func timeoutMiddleware(handler http.Handler) http.Handler {
+	timeoutHandler := http.TimeoutHandler(handler, handlerTimeout, `{"status":503,"message":"request timed out"}`)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeoutHandler.ServeHTTP(timeoutResponseWriter{w}, r)
+	})
+}
+
+func bookRoute(handler http.HandlerFunc) http.Handler {
+	return corsMiddleware(rateLimitMiddleware(schemaVersionMiddleware(optionalAuthMiddleware(readinessMiddleware(gzipRequestMiddleware(bodyLogMiddleware(timeoutMiddleware(dedupMiddleware(handler)))))))))
+}
+
+// bulkRoute is bookRoute without the handler timeout: exports and imports
+// stream for as long as the data takes, bounded by bulkLimitMiddleware.
+func bulkRoute(handler http.HandlerFunc) http.Handler {
+	return corsMiddleware(rateLimitMiddleware(schemaVersionMiddleware(optionalAuthMiddleware(readinessMiddleware(gzipRequestMiddleware(bodyLogMiddleware(dedupMiddleware(handler))))))))
+}
+
 func SetupRoutes(apiBasePath string) {
 
-	BooksHandler := http.HandlerFunc(handleBooks)
-	http.Handle(fmt.Sprintf("%s/%s", apiBasePath, bookPath), corsMiddleware(BooksHandler))
+	routes := bookRoutes()
+	for _, route := range routes {
+		http.Handle(apiBasePath+route.pattern, route.handler)
+	}
+	http.Handle(fmt.Sprintf("%s/postman.json", apiBasePath), corsMiddleware(handlePostmanCollection(apiBasePath, routes)))
 
-	bookHandler := http.HandlerFunc(handleBook)
-	http.Handle(fmt.Sprintf("%s/%s/", apiBasePath, bookPath), corsMiddleware(bookHandler))
+	http.Handle(fmt.Sprintf("%s/ready", apiBasePath), http.HandlerFunc(handleReady))
+	http.Handle(fmt.Sprintf("%s/debug/dbstats", apiBasePath), debugMiddleware(readinessMiddleware(http.HandlerFunc(handleDBStats))))
+	http.Handle(fmt.Sprintf("%s/debug/schema-check", apiBasePath), debugMiddleware(readinessMiddleware(http.HandlerFunc(handleSchemaCheck))))
+	http.Handle("/admin", readinessMiddleware(requireAuth(handleAdmin)))
+	http.Handle("/admin/books", readinessMiddleware(requireAuth(handleAdminAddBook)))
+	http.Handle("/admin/books/delete", readinessMiddleware(requireAuth(handleAdminDeleteBook)))
 
 }
 
-func SetupDB() {
-	var err error
-	Db, err = sql.Open("mysql", "root:root@tcp(127.0.0.1:3306)/bookdb")
+func mysqlDSN(dsn string) (string, error) {
+	cfg, err := mysql.ParseDSN(dsn)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
+	}
+	cfg.ParseTime = true
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	if _, ok := cfg.Params["time_zone"]; !ok {
+		cfg.Params["time_zone"] = "'+00:00'"
+	}
+	return cfg.FormatDSN(), nil
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	if dbDriver == "mysql" {
+		var err error
+		dsn, err = mysqlDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	db, err := openJitteredDB(dbDriver, dsn, connMaxLifetime, connLifetimeJitter)
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxLifetime(connMaxLifetime + connLifetimeJitter)
+	db.SetMaxOpenConns(dbMaxOpenConns)
+	db.SetMaxIdleConns(dbMaxIdleConns)
+	if poolRampPeriod > 0 && poolRampStart > 0 && poolRampStart < dbMaxOpenConns {
+		setPoolSize(db, poolRampStart)
+		go runPoolRamp(db, poolRampStart, dbMaxOpenConns, poolRampPeriod)
+	}
+	return db, nil
+}
+
+func SetupDB() error {
+	if !identifierPattern.MatchString(booksTable) {
+		return fmt.Errorf("invalid BOOKS_TABLE %q", booksTable)
+	}
+	switch publisherCheckMode {
+	case publisherCheckOff, publisherCheckWarn, publisherCheckStrict:
+	default:
+		return fmt.Errorf("invalid PUBLISHER_VALIDATION %q", publisherCheckMode)
+	}
+	if changesSafetyLag <= dbTimeout {
+		return fmt.Errorf("CHANGES_SAFETY_LAG must be longer than the %s database timeout", dbTimeout)
+	}
+	switch jsonNaming {
+	case namingLower, namingSnake, namingCamel:
+	default:
+		return fmt.Errorf("invalid JSON_NAMING %q", jsonNaming)
+	}
+	switch emptyFieldsMode {
+	case emptyFieldsEmpty, emptyFieldsNull, emptyFieldsOmit:
+	default:
+		return fmt.Errorf("invalid EMPTY_FIELDS %q", emptyFieldsMode)
+	}
+	if _, err := parseIsolationLevel(txIsolation); err != nil {
+		return err
+	}
+	if !isSortColumn(strings.TrimPrefix(defaultSort, "-")) {
+		return fmt.Errorf("invalid DEFAULT_SORT %q", defaultSort)
+	}
+	fields, err := parseFields(publicFieldsSetting)
+	if err != nil {
+		return fmt.Errorf("invalid PUBLIC_FIELDS: %w", err)
+	}
+	publicFields = fields
+	if auditLogFile != "" {
+		if err := openAuditSink(auditLogFile); err != nil {
+			return fmt.Errorf("could not open AUDIT_LOG_FILE: %w", err)
+		}
+	}
+	dsn, err := databaseDSN()
+	if err != nil {
+		return err
+	}
+	Db, err = openDB(dsn)
+	if err != nil {
+		return err
 	}
 	fmt.Println(Db)
-	Db.SetConnMaxLifetime(time.Minute * 3)
-	Db.SetMaxOpenConns(10)
-	Db.SetMaxIdleConns(10)
+	readReplicas = nil
+	for _, replicaDSN := range replicaDSNs() {
+		replica, err := openDB(replicaDSN)
+		if err != nil {
+			return err
+		}
+		readReplicas = append(readReplicas, replica)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := Db.PingContext(ctx); err != nil {
+		return err
+	}
+	if err := runMigrations(); err != nil {
+		return err
+	}
+	if uniqueTitles {
+		if err := ensureUniqueTitleIndex(); err != nil {
+			return err
+		}
+	}
+	if warmConnections > 0 {
+		warmed, err := warmPool(ctx, Db, warmConnections)
+		if err != nil {
+			return err
+		}
+		log.Printf("warmed %d database connections", warmed)
+	}
+	ready.Store(true)
+	return nil
 }
 
 func main() {
-	SetupDB()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	SetupRoutes(basePath)
-	log.Fatal(http.ListenAndServe(":5000", nil))
+
+	server := &http.Server{Addr: ":5000"}
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		defer stopQueue()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Print(err)
+		}
+	}()
+	go func() {
+		if err := SetupDB(); err != nil {
+			log.Fatal(err)
+		}
+		if listCacheFallback {
+			go listSnapshots.runSweeper(ctx, listCacheSweepInterval)
+		}
+		if writeQueueEnabled {
+			go bookWriteQueue.run(queueCtx, writeQueueInterval, writeQueueBatchSize)
+		}
+		if softDelete {
+			runPruneLoop(ctx, pruneInterval, softDeleteRetention)
+		}
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-shutdownDone
+	if writeQueueEnabled && ready.Load() {
+		<-bookWriteQueue.done
+	}
 }
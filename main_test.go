@@ -0,0 +1,725 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddlewareAbortsSlowHandler(t *testing.T) {
+	setForTest(t, &handlerTimeout, 20*time.Millisecond)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			w.Write([]byte("too late"))
+		}
+	})
+	start := time.Now()
+	w := serve(timeoutMiddleware(slow), http.MethodGet, "/api/books", "", nil)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("handler was not aborted at the deadline, took %s", elapsed)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After")
+	}
+	if !strings.Contains(w.Body.String(), "request timed out") {
+		t.Errorf("body = %q", w.Body.String())
+	}
+}
+
+func TestBulkRouteSkipsHandlerTimeout(t *testing.T) {
+	setForTest(t, &handlerTimeout, 10*time.Millisecond)
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("done"))
+	}
+	w := serve(bulkRoute(slow), http.MethodGet, "/api/books/export", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "done" {
+		t.Fatalf("bulk route: %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(bookRoute(slow), http.MethodGet, "/api/books", "", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("book route: status = %d, want 503", w.Code)
+	}
+}
+
+func TestTimeoutMiddlewarePassesFastHandler(t *testing.T) {
+	setForTest(t, &handlerTimeout, time.Second)
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	w := serve(timeoutMiddleware(fast), http.MethodGet, "/api/books", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestValidateBooksReportsEachRecord(t *testing.T) {
+	fake := useFakeDB(t, nil)
+	body := `[
+		{"bookname":"Dune","author":"Frank Herbert"},
+		{"bookname":"","author":"Nobody","stock":-1},
+		{"bookname":"Emma","author":"Jane Austen","status":"archived"}
+	]`
+	w := serve(http.HandlerFunc(handleValidateBooks), http.MethodPost, "/api/books/validate", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var results []validationResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if !results[0].Valid || len(results[0].Errors) != 0 {
+		t.Errorf("record 0 = %+v, want valid", results[0])
+	}
+	if results[1].Valid || len(results[1].Errors) != 2 {
+		t.Errorf("record 1 = %+v, want two errors", results[1])
+	}
+	if results[2].Valid || results[2].Index != 2 {
+		t.Errorf("record 2 = %+v, want invalid status", results[2])
+	}
+	if queries := fake.queries(); len(queries) != 0 {
+		t.Errorf("validation touched the database: %v", queries)
+	}
+}
+
+func TestValidateBooksAppliesDefaultsFirst(t *testing.T) {
+	setForTest(t, &defaultPublisher, "Unknown")
+	setForTest(t, &publisherCheckMode, publisherCheckStrict)
+	setForTest(t, &knownPublishers, map[string]bool{"unknown": true})
+	body := `[{"bookname":"Dune","author":"Frank Herbert","isbn":"978-0-13-419044-0"}]`
+	w := serve(http.HandlerFunc(handleValidateBooks), http.MethodPost, "/api/books/validate", body, nil)
+	var results []validationResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].Valid {
+		t.Fatalf("results = %+v, want the defaulted record to be valid", results)
+	}
+}
+
+func TestCreateBookAppliesDefaultGenreAndPublisher(t *testing.T) {
+	setForTest(t, &defaultGenre, "Uncategorized")
+	setForTest(t, &defaultPublisher, "Self-published")
+	fake := useFakeDB(t, bookStore(nil, 7))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Location"); got != "/api/books/7" {
+		t.Errorf("Location = %q", got)
+	}
+	insert, ok := fake.find("INSERT INTO books ")
+	if !ok {
+		t.Fatalf("no insert in %v", fake.queries())
+	}
+	if insert.args[3] != "Uncategorized" || insert.args[4] != "Self-published" {
+		t.Errorf("genre, publisher = %v, %v", insert.args[3], insert.args[4])
+	}
+}
+
+func TestCreateBookKeepsBlankGenreWhenDefaultIsEmpty(t *testing.T) {
+	setForTest(t, &defaultGenre, "")
+	fake := useFakeDB(t, bookStore(nil, 7))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	insert, _ := fake.find("INSERT INTO books ")
+	if insert.args[3] != "" {
+		t.Errorf("genre = %v, want empty", insert.args[3])
+	}
+}
+
+func genreBooks() []Book {
+	books := []Book{testBook(1, "Dune"), testBook(2, "Foundation"), testBook(3, "Neuromancer"), testBook(4, "Emma")}
+	books[0].Genre, books[1].Genre, books[2].Genre, books[3].Genre = "Fiction", "Fiction", "Fiction", "Romance"
+	return books
+}
+
+func TestGetBooksGroupedByGenre(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(genreBooks()...)
+	})
+	groups, err := getBooksGroupedByGenre(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || len(groups["Fiction"]) != 3 || len(groups["Romance"]) != 1 {
+		t.Fatalf("groups = %v", groups)
+	}
+	if groups["Romance"][0].BookName != "Emma" {
+		t.Errorf("Romance = %v", groups["Romance"])
+	}
+}
+
+func TestGetBooksGroupedByGenreLimitsEachGroup(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(genreBooks()...)
+	})
+	groups, err := getBooksGroupedByGenre(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups["Fiction"]) != 2 || groups["Fiction"][1].BookName != "Foundation" {
+		t.Errorf("Fiction = %v, want the first two books", groups["Fiction"])
+	}
+	if len(groups["Romance"]) != 1 {
+		t.Errorf("Romance = %v", groups["Romance"])
+	}
+}
+
+func TestBooksByGenreRejectsBadLimit(t *testing.T) {
+	w := serve(http.HandlerFunc(handleBooksByGenre), http.MethodGet, "/api/books/by-genre?limit_per_genre=-1", "", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestOptionsDescribesCollection(t *testing.T) {
+	w := serve(http.HandlerFunc(handleBooks), http.MethodOptions, "/api/books", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var got capabilities
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got.Methods, ",") != "GET,POST,PATCH,OPTIONS" {
+		t.Errorf("methods = %v", got.Methods)
+	}
+	if !contains(got.Filters, "author") || !contains(got.Sort, "bookname") {
+		t.Errorf("capabilities = %+v", got)
+	}
+	if got := w.Header().Get("Allow"); got != "GET, POST, PATCH, OPTIONS" {
+		t.Errorf("Allow = %q", got)
+	}
+}
+
+func TestOptionsPreflightHasNoBody(t *testing.T) {
+	w := serve(http.HandlerFunc(handleBooks), http.MethodOptions, "/api/books", "", map[string]string{"Access-Control-Request-Method": "POST"})
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func contains(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCustomBooksTableInSQL(t *testing.T) {
+	setForTest(t, &booksTable, "tenant_books")
+	if query := insertBooksQuery(1); !strings.HasPrefix(query, "INSERT INTO tenant_books (") {
+		t.Errorf("insert = %q", query)
+	}
+	if query, _ := (bookFilter{Status: statusPublished}).listQuery(0); !strings.Contains(query, " FROM tenant_books WHERE ") {
+		t.Errorf("list = %q", query)
+	}
+	fake := useFakeDB(t, bookStore(nil, 0))
+	if _, err := getBook(1); err != nil {
+		t.Fatal(err)
+	}
+	if queries := fake.queries(); len(queries) != 1 || !strings.Contains(queries[0], "FROM tenant_books WHERE bookid = ?") {
+		t.Errorf("queries = %v", queries)
+	}
+}
+
+func TestSetupDBRejectsInvalidTableName(t *testing.T) {
+	setForTest(t, &booksTable, "books; DROP TABLE books")
+	if err := SetupDB(); err == nil || !strings.Contains(err.Error(), "invalid BOOKS_TABLE") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestCopyBook(t *testing.T) {
+	copied := testBook(9, "Dune (Copy)")
+	copied.Status = statusDraft
+	fake := useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune"), 9: copied}, 9))
+	w := serve(http.HandlerFunc(handleBook), http.MethodPost, "/api/books/1/copy", "", nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var book Book
+	if err := json.Unmarshal(w.Body.Bytes(), &book); err != nil {
+		t.Fatal(err)
+	}
+	if book.BookID != 9 || book.BookName != "Dune (Copy)" {
+		t.Errorf("book = %+v", book)
+	}
+	insert, ok := fake.find("INSERT INTO books ")
+	if !ok {
+		t.Fatalf("no insert in %v", fake.queries())
+	}
+	if insert.args[0] != int64(0) || insert.args[1] != "Dune (Copy)" || insert.args[8] != statusDraft {
+		t.Errorf("insert args = %v", insert.args)
+	}
+}
+
+func TestCopyMissingBook(t *testing.T) {
+	fake := useFakeDB(t, bookStore(nil, 9))
+	w := serve(http.HandlerFunc(handleBook), http.MethodPost, "/api/books/1/copy", "", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+	if _, ok := fake.find("INSERT"); ok {
+		t.Error("copy of a missing book inserted a row")
+	}
+}
+
+func TestCreateBookParseErrorIs400(t *testing.T) {
+	useFakeDB(t, bookStore(nil, 1))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestCreateBookValidationErrorIs422(t *testing.T) {
+	useFakeDB(t, bookStore(nil, 1))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune"}`, nil)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "author is required") {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
+
+func TestCreateBookValidationErrorCanBe400(t *testing.T) {
+	setForTest(t, &validationUnprocessable, false)
+	useFakeDB(t, bookStore(nil, 1))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune"}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestValidateBookCoverURL(t *testing.T) {
+	book := testBook(0, "Dune")
+	for _, tc := range []struct {
+		url   string
+		valid bool
+	}{
+		{"https://covers.example.com/dune.jpg", true},
+		{"http://example.com/a.png", true},
+		{"", true},
+		{"not a url", false},
+		{"ftp://example.com/a.png", false},
+		{"/relative/path.jpg", false},
+	} {
+		book.CoverURL = tc.url
+		errs := validateBook(book)
+		if valid := len(errs) == 0; valid != tc.valid {
+			t.Errorf("cover_url %q: errors = %v, want valid=%t", tc.url, errs, tc.valid)
+		}
+	}
+}
+
+func TestCreateBookRejectsMalformedCoverURL(t *testing.T) {
+	setForTest(t, &validationUnprocessable, false)
+	fake := useFakeDB(t, bookStore(nil, 1))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert","cover_url":"dune.jpg"}`, nil)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "cover_url must be an absolute http or https URL") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
+
+func TestSetBookLocation(t *testing.T) {
+	fake := useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	w := serve(http.HandlerFunc(handleBook), http.MethodPut, "/api/books/1/location", `{"shelf":"A1","position":3}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var book Book
+	if err := json.Unmarshal(w.Body.Bytes(), &book); err != nil {
+		t.Fatal(err)
+	}
+	if book.Shelf != "A1" || book.Position != 3 {
+		t.Errorf("book = %+v", book)
+	}
+	update, ok := fake.find("UPDATE books SET shelf = ?, position = ?")
+	if !ok || update.args[0] != "A1" || update.args[1] != int64(3) || update.args[2] != int64(1) {
+		t.Errorf("update = %+v", update)
+	}
+}
+
+func TestSetBookLocationRejectsNegativePosition(t *testing.T) {
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	w := serve(http.HandlerFunc(handleBook), http.MethodPut, "/api/books/1/location", `{"shelf":"A1","position":-1}`, nil)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestListShelfSortedByPosition(t *testing.T) {
+	first, second := testBook(2, "Emma"), testBook(1, "Dune")
+	first.Shelf, first.Position = "A1", 1
+	second.Shelf, second.Position = "A1", 2
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(first, second)
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?shelf=A1&sort=position", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var books []Book
+	if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || books[0].Position != 1 || books[1].Position != 2 {
+		t.Errorf("books = %+v", books)
+	}
+	list, _ := fake.find("SELECT")
+	if !strings.Contains(list.query, "LOWER(shelf) = LOWER(?)") || !strings.HasSuffix(list.query, "ORDER BY position, bookid LIMIT 10001") {
+		t.Errorf("query = %q", list.query)
+	}
+	if list.args[0] != "A1" {
+		t.Errorf("args = %v", list.args)
+	}
+}
+
+func TestBookIDAcceptsNumberOrNumericString(t *testing.T) {
+	for _, body := range []string{`{"bookid":5,"bookname":"Dune"}`, `{"bookid":"5","bookname":"Dune"}`, `{"bookid":" 5 ","bookname":"Dune"}`} {
+		var book Book
+		if err := json.Unmarshal([]byte(body), &book); err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+		if book.BookID != 5 || book.BookName != "Dune" {
+			t.Errorf("%s decoded to %+v", body, book)
+		}
+	}
+}
+
+func TestBookIDRejectsNonNumericString(t *testing.T) {
+	for _, body := range []string{`{"bookid":"abc"}`, `{"bookid":"5.5"}`, `{"bookid":true}`} {
+		var book Book
+		if err := json.Unmarshal([]byte(body), &book); err == nil {
+			t.Errorf("%s: expected an error", body)
+		}
+	}
+}
+
+func TestDraftsHiddenUntilPublished(t *testing.T) {
+	draft := testBook(2, "Draft")
+	draft.Status = statusDraft
+	books := map[int]Book{1: testBook(1, "Published"), 2: draft}
+	store := bookStore(books, 0)
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "UPDATE books SET status = ?"):
+			book := books[int(args[1].(int64))]
+			book.Status = args[0].(string)
+			books[book.BookID] = book
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "ORDER BY"):
+			var rows []Book
+			for _, id := range []int{1, 2} {
+				if !strings.Contains(query, "status = ?") || books[id].Status == args[0] {
+					rows = append(rows, books[id])
+				}
+			}
+			return bookRows(rows...)
+		}
+		return store(query, args)
+	})
+	useAdminCredentials(t)
+	list := func(target string) []string {
+		w := serve(optionalAuthMiddleware(http.HandlerFunc(handleBooks)), http.MethodGet, target, "", map[string]string{"Authorization": adminAuth})
+		var got []Book
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v", w.Body.String(), err)
+		}
+		names := make([]string, len(got))
+		for i, book := range got {
+			names[i] = book.BookName
+		}
+		return names
+	}
+	if got := strings.Join(list("/api/books"), ","); got != "Published" {
+		t.Errorf("public list = %s", got)
+	}
+	if got := strings.Join(list("/api/books?status=all"), ","); got != "Published,Draft" {
+		t.Errorf("status=all list = %s", got)
+	}
+	if w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?status=all", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous status=all: status = %d, want 401", w.Code)
+	}
+	w := serve(http.HandlerFunc(handleBook), http.MethodPost, "/api/books/2/publish", "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"published"`) {
+		t.Fatalf("publish: %d %s", w.Code, w.Body.String())
+	}
+	if got := strings.Join(list("/api/books"), ","); got != "Published,Draft" {
+		t.Errorf("public list after publish = %s", got)
+	}
+}
+
+func TestPublishMissingBook(t *testing.T) {
+	useFakeDB(t, bookStore(nil, 0))
+	w := serve(http.HandlerFunc(handleBook), http.MethodPost, "/api/books/3/publish", "", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestStrictJSONRejectsUnknownFields(t *testing.T) {
+	setForTest(t, &strictJSON, true)
+	fake := useFakeDB(t, bookStore(nil, 1))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert","extra":1}`, nil)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `unknown field \"extra\"`) {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
+
+func TestLenientJSONIgnoresUnknownFields(t *testing.T) {
+	setForTest(t, &strictJSON, false)
+	useFakeDB(t, bookStore(nil, 1))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert","extra":1}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSetupDBReturnsErrorForBadDriver(t *testing.T) {
+	setForTest(t, &dbDriver, "no-such-driver")
+	t.Setenv("DB_DSN", "u:p@tcp(127.0.0.1:1)/db")
+	previousDB := Db
+	t.Cleanup(func() { Db = previousDB })
+	err := SetupDB()
+	if err == nil || !strings.Contains(err.Error(), `unknown driver "no-such-driver"`) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestListRowCapTriggers(t *testing.T) {
+	setForTest(t, &maxListRows, 2)
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(testBook(1, "Dune"), testBook(2, "Emma"), testBook(3, "Ulysses"))
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", nil)
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "exceeds 2 rows") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if list, _ := fake.find("SELECT"); !strings.HasSuffix(list.query, " LIMIT 3") {
+		t.Errorf("query = %q, want the scan bounded at cap+1", list.query)
+	}
+}
+
+func TestListRowCapAllowsExactlyCap(t *testing.T) {
+	setForTest(t, &maxListRows, 2)
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(testBook(1, "Dune"), testBook(2, "Emma"))
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestListIDsOnly(t *testing.T) {
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{columns: []string{"bookid"}, rows: [][]driver.Value{{int64(1)}, {int64(2)}, {int64(3)}}}
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?ids_only=true&genre=Programming", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "[1,2,3]\n" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	list, _ := fake.find("SELECT")
+	if !strings.HasPrefix(list.query, "SELECT bookid FROM books WHERE ") || len(list.args) == 0 || list.args[len(list.args)-1] != "Programming" {
+		t.Errorf("query = %q %v", list.query, list.args)
+	}
+}
+
+func TestBookPathRejectsOutOfRangeIDs(t *testing.T) {
+	fake := useFakeDB(t, nil)
+	for _, id := range []string{"0", "-5", "2147483648", "99999999999999999999"} {
+		w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/"+id, "", nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("id %s: status = %d", id, w.Code)
+		}
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v, want none", fake.queries())
+	}
+}
+
+func TestMaxBookIDIsConfigurable(t *testing.T) {
+	setForTest(t, &maxBookID, 1000)
+	useFakeDB(t, bookStore(map[int]Book{1000: testBook(1000, "Dune")}, 0))
+	if w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1000", "", nil); w.Code != http.StatusOK {
+		t.Errorf("id at the limit: status = %d", w.Code)
+	}
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1001", "", nil)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "at most 1000") {
+		t.Errorf("id past the limit: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestConfirmInsertsReadsBackFromPrimary(t *testing.T) {
+	setForTest(t, &confirmInserts, true)
+	store := &insertStore{nextID: 41}
+	primary := useFakeDB(t, store.handle)
+	replica, replicaFake := openFakeDB(t, t.Name()+"/replica", bookStore(nil, 0))
+	readReplicas = []*sql.DB{replica}
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert"}`, nil)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/books/42" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	var created Book
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.BookID != 42 || created.BookName != "Dune" {
+		t.Fatalf("body = %s (%v)", w.Body.String(), err)
+	}
+	queries := primary.queries()
+	if last := queries[len(queries)-1]; !strings.Contains(last, "WHERE bookid = ?") {
+		t.Errorf("last primary query = %q, want the read-back", last)
+	}
+	if len(replicaFake.queries()) != 0 {
+		t.Errorf("replica saw %v", replicaFake.queries())
+	}
+}
+
+func TestConfirmInsertsFailsWhenRowIsMissing(t *testing.T) {
+	setForTest(t, &confirmInserts, true)
+	useFakeDB(t, bookStore(nil, 7))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert"}`, nil)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "could not confirm created book") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func nullPublisherDB(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		result := bookRows(testBook(1, "Dune"))
+		result.rows[0][bookColumnIndex("publisher")] = nil
+		result.rows[0][bookColumnIndex("genre")] = nil
+		return result
+	})
+}
+
+func TestNullPublisherScansAsEmpty(t *testing.T) {
+	nullPublisherDB(t)
+	book, err := getBook(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.Publisher != "" || book.Genre != "" || book.Author != "Alan Donovan" {
+		t.Errorf("book = %+v", book)
+	}
+	books, err := getBookList(bookFilter{})
+	if err != nil || len(books) != 1 {
+		t.Fatalf("list = %+v, %v, want the row kept", books, err)
+	}
+}
+
+func TestStrictNullScanRejectsNull(t *testing.T) {
+	setForTest(t, &strictNullScan, true)
+	nullPublisherDB(t)
+	if _, err := getBook(1); err == nil || !strings.Contains(err.Error(), "unexpected NULL") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestBookIDBeyondIntRangeIsOutOfRange(t *testing.T) {
+	for _, id := range []string{"9223372036854775808", "2147483648"} {
+		w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/"+id, "", nil)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "id out of range, must be at most 2147483647") {
+			t.Errorf("%s: got %d %s", id, w.Code, w.Body.String())
+		}
+	}
+	if _, err := parseBookID("2147483647"); err != nil {
+		t.Errorf("largest INT id rejected: %v", err)
+	}
+}
+
+func TestEmptyListIs200ByDefault(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult { return bookRows() })
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?genre=Poetry", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "[]\n" {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestEmptyListNoContentMode(t *testing.T) {
+	setForTest(t, &emptyListNoContent, true)
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "SELECT bookid FROM") {
+			return fakeResult{columns: []string{"bookid"}}
+		}
+		return bookRows()
+	})
+	for _, target := range []string{"/api/books?genre=Poetry", "/api/books?genre=Poetry&ids_only=true"} {
+		w := serve(http.HandlerFunc(handleBooks), http.MethodGet, target, "", nil)
+		if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+			t.Errorf("%s: got %d %q", target, w.Code, w.Body.String())
+		}
+	}
+	books, err := getBookList(bookFilter{})
+	if err != nil || books == nil {
+		t.Errorf("getBookList = %#v, %v, want a non-nil empty slice", books, err)
+	}
+}
+
+func midScanFailureDB(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		result := bookRows(testBook(1, "Dune"), testBook(2, "Emma"))
+		result.rowsErr = errors.New("connection reset by peer")
+		return result
+	})
+}
+
+func TestAllowPartialServesRowsReadBeforeFailure(t *testing.T) {
+	midScanFailureDB(t)
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?allow_partial=true", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var books []Book
+	if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil || len(books) != 2 || books[1].BookName != "Emma" {
+		t.Errorf("body = %s", w.Body.String())
+	}
+	if got := w.Header().Get("Warning"); got != `299 - "partial results: read failed after 2 books"` {
+		t.Errorf("Warning = %q", got)
+	}
+}
+
+func TestPartialListFailsClosedByDefault(t *testing.T) {
+	midScanFailureDB(t)
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", nil)
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Warning") != "" {
+		t.Fatalf("got %d, Warning %q", w.Code, w.Header().Get("Warning"))
+	}
+}
+
+func TestAllowPartialStillFailsWithoutRows(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{columns: strings.Split(bookColumns, ", "), rowsErr: errors.New("connection reset by peer")}
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?allow_partial=true", "", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+type mergeRequest struct {
+	Keep   int `json:"keep"`
+	Remove int `json:"remove"`
+}
+
+var errMergeNotFound = errors.New("book to merge not found")
+
+func mergeBooks(keepID, removeID int, actor string) (*Book, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	var kept *Book
+	err = retryWrites(ctx, func() error {
+		tx, err := beginTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer rollbackTx(tx)
+		kept, err = getBookTx(ctx, tx, keepID)
+		if err != nil {
+			return err
+		}
+		removed, err := getBookTx(ctx, tx, removeID)
+		if err != nil {
+			return err
+		}
+		if kept == nil || removed == nil {
+			return errMergeNotFound
+		}
+		if _, err := txExecContext(ctx, tx, fmt.Sprintf(`INSERT IGNORE INTO %[1]s_book_tags (bookid, tag_id) SELECT ?, tag_id FROM %[1]s_book_tags WHERE bookid = ?`, booksTable), keepID, removeID); err != nil {
+			return err
+		}
+		if _, err := txExecContext(ctx, tx, fmt.Sprintf(`DELETE FROM %s_book_tags WHERE bookid = ?`, booksTable), removeID); err != nil {
+			return err
+		}
+		if _, err := txExecContext(ctx, tx, fmt.Sprintf(`UPDATE %s_audit SET bookid = ? WHERE bookid = ?`, booksTable), keepID, removeID); err != nil {
+			return err
+		}
+		query := fmt.Sprintf(`DELETE FROM %s WHERE bookid = ?`, booksTable)
+		if softDelete {
+			query = fmt.Sprintf(`UPDATE %s SET deleted_at = NOW() WHERE bookid = ? AND deleted_at IS NULL`, booksTable)
+		}
+		if _, err := auditedExecTx(ctx, tx, actor, auditDelete, removeID, query, removeID); err != nil {
+			return err
+		}
+		return commitTx(tx)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	publishBookChange(auditDelete, removeID)
+	publishBookChange(auditUpdate, keepID)
+	return kept, nil
+}
+
+func handleMergeBooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var request mergeRequest
+		if err := decodeJSON(r.Body, &request); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid merge payload: "+err.Error())
+			return
+		}
+		if !bookIDInRange(request.Keep) || !bookIDInRange(request.Remove) {
+			writeError(w, r, http.StatusBadRequest, "keep and remove must be valid book ids")
+			return
+		}
+		if request.Keep == request.Remove {
+			writeError(w, r, http.StatusBadRequest, "keep and remove must be different books")
+			return
+		}
+		book, err := mergeBooks(request.Keep, request.Remove, requestActor(r))
+		if errors.Is(err, errMergeNotFound) {
+			writeError(w, r, http.StatusNotFound, "book not found")
+			return
+		}
+		if err != nil {
+			writeDBError(w, r, err, "could not merge books")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, visibleBook(r, book))
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
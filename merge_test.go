@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// mergeStore is a bookStore whose deletes remove the book, so the merged-away
+// id can be checked afterwards.
+func mergeStore(books map[int]Book) func(string, []driver.Value) fakeResult {
+	store := bookStore(books, 0)
+	return func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "DELETE FROM books WHERE bookid = ?") || strings.HasPrefix(query, "UPDATE books SET deleted_at = NOW()") {
+			delete(books, int(args[0].(int64)))
+			return fakeResult{affected: 1}
+		}
+		return store(query, args)
+	}
+}
+
+func TestMergeReassignsDependentsAndRemovesBook(t *testing.T) {
+	useAdminCredentials(t)
+	books := map[int]Book{5: testBook(5, "Dune"), 9: testBook(9, "Dune")}
+	fake := useFakeDB(t, mergeStore(books))
+	w := serve(requireAuth(handleMergeBooks), http.MethodPost, "/api/books/merge", `{"keep":5,"remove":9}`, map[string]string{"Authorization": adminAuth})
+	var kept Book
+	if err := json.Unmarshal(w.Body.Bytes(), &kept); err != nil || w.Code != http.StatusOK || kept.BookID != 5 {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	for _, query := range []string{
+		"INSERT IGNORE INTO books_book_tags (bookid, tag_id) SELECT ?, tag_id FROM books_book_tags WHERE bookid = ?",
+		"UPDATE books_audit SET bookid = ? WHERE bookid = ?",
+	} {
+		statement, ok := fake.find(query)
+		if !ok || statement.args[0] != int64(5) || statement.args[1] != int64(9) {
+			t.Errorf("%s: %+v", query, statement)
+		}
+	}
+	if _, ok := books[9]; ok {
+		t.Error("book 9 still exists")
+	}
+	if removed, err := getBook(9); err != nil || removed != nil {
+		t.Errorf("getBook(9) = %+v, %v", removed, err)
+	}
+	if fake.commits != 1 {
+		t.Errorf("commits = %d, want one transaction", fake.commits)
+	}
+}
+
+func TestMergeMissingBookRollsBack(t *testing.T) {
+	useAdminCredentials(t)
+	fake := useFakeDB(t, mergeStore(map[int]Book{5: testBook(5, "Dune")}))
+	w := serve(requireAuth(handleMergeBooks), http.MethodPost, "/api/books/merge", `{"keep":5,"remove":9}`, map[string]string{"Authorization": adminAuth})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if fake.commits != 0 || fake.rollbacks != 1 {
+		t.Errorf("commits = %d, rollbacks = %d", fake.commits, fake.rollbacks)
+	}
+	w = serve(requireAuth(handleMergeBooks), http.MethodPost, "/api/books/merge", `{"keep":5,"remove":5}`, map[string]string{"Authorization": adminAuth})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("self merge: status = %d", w.Code)
+	}
+}
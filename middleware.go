@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var (
+	debugHTTPBodies   = getEnvBool("DEBUG_HTTP_BODIES", false)
+	debugHTTPBodySize = getEnvInt("DEBUG_HTTP_BODY_LIMIT", 4096)
+)
+
+func truncateBody(body []byte, limit int) []byte {
+	if limit >= 0 && len(body) > limit {
+		return body[:limit]
+	}
+	return body
+}
+
+type bodyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	limit  int
+}
+
+func (rec *bodyRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *bodyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if remaining := rec.limit - rec.body.Len(); remaining > 0 {
+		rec.body.Write(truncateBody(b, remaining))
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func bodyLogMiddleware(handler http.Handler) http.Handler {
+	if !debugHTTPBodies {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var requestBody []byte
+		if r.Body != nil {
+			var err error
+			requestBody, err = io.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				log.Print(err)
+			}
+			r.Body = io.NopCloser(bytes.NewReader(requestBody))
+		}
+		log.Printf("http request: %s %s body=%q", r.Method, r.URL, truncateBody(requestBody, debugHTTPBodySize))
+		rec := &bodyRecorder{ResponseWriter: w, limit: debugHTTPBodySize}
+		handler.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		log.Printf("http response: %s %s status=%d body=%q", r.Method, r.URL, rec.status, rec.body.Bytes())
+	})
+}
+
+var maxDecompressedBody = int64(getEnvInt("MAX_DECOMPRESSED_BODY", 64<<20))
+
+type gzipBody struct {
+	io.Reader
+	gz   *gzip.Reader
+	body io.ReadCloser
+}
+
+func (b gzipBody) Close() error {
+	b.gz.Close()
+	return b.body.Close()
+}
+
+func gzipRequestMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(strings.TrimSpace(r.Header.Get("Content-Encoding")), "gzip") || r.Body == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			log.Print(err)
+			writeError(w, r, http.StatusBadRequest, "malformed gzip request body")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, gzipBody{Reader: gz, gz: gz, body: r.Body}, maxDecompressedBody)
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Write([]byte("echo:" + string(body)))
+}
+
+func TestBodyLogMiddlewareLogsBodies(t *testing.T) {
+	setForTest(t, &debugHTTPBodies, true)
+	setForTest(t, &debugHTTPBodySize, 4096)
+	logs := captureLog(t)
+	w := serve(bodyLogMiddleware(http.HandlerFunc(echoHandler)), http.MethodPost, "/api/books", `{"bookname":"Dune"}`, nil)
+	if w.Body.String() != `echo:{"bookname":"Dune"}` {
+		t.Fatalf("handler saw body %q", w.Body.String())
+	}
+	got := logs.String()
+	if !strings.Contains(got, `http request: POST /api/books body="{\"bookname\":\"Dune\"}"`) {
+		t.Errorf("request not logged: %q", got)
+	}
+	if !strings.Contains(got, `http response: POST /api/books status=200 body="echo:{\"bookname\":\"Dune\"}"`) {
+		t.Errorf("response not logged: %q", got)
+	}
+}
+
+func TestBodyLogMiddlewareCapsBodies(t *testing.T) {
+	setForTest(t, &debugHTTPBodies, true)
+	setForTest(t, &debugHTTPBodySize, 4)
+	logs := captureLog(t)
+	w := serve(bodyLogMiddleware(http.HandlerFunc(echoHandler)), http.MethodPost, "/api/books", "abcdefgh", nil)
+	if w.Body.String() != "echo:abcdefgh" {
+		t.Fatalf("handler saw body %q", w.Body.String())
+	}
+	if got := logs.String(); !strings.Contains(got, `body="abcd"`) || strings.Contains(got, "abcde") {
+		t.Errorf("log = %q", got)
+	}
+}
+
+func TestBodyLogMiddlewareOffByDefault(t *testing.T) {
+	setForTest(t, &debugHTTPBodies, false)
+	logs := captureLog(t)
+	serve(bodyLogMiddleware(http.HandlerFunc(echoHandler)), http.MethodPost, "/api/books", "abc", nil)
+	if logs.Len() != 0 {
+		t.Errorf("log = %q", logs.String())
+	}
+}
+
+func TestOnlyBookRoutesGetCORSAndJSON(t *testing.T) {
+	SetupRoutes("/cors-test")
+	books := serve(http.DefaultServeMux, http.MethodOptions, "/cors-test/books", "", map[string]string{"Access-Control-Request-Method": "GET"})
+	if books.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("book route is missing CORS headers: %v", books.Header())
+	}
+	ready := serve(http.DefaultServeMux, http.MethodGet, "/cors-test/ready", "", nil)
+	for key := range ready.Header() {
+		if strings.HasPrefix(key, "Access-Control-") {
+			t.Errorf("ready endpoint got CORS header %s", key)
+		}
+	}
+	if got := ready.Header().Values("Content-Type"); len(got) != 1 || got[0] != "application/json" {
+		t.Errorf("ready Content-Type = %v", got)
+	}
+	setForTest(t, &debugEndpoints, false)
+	debug := serve(http.DefaultServeMux, http.MethodGet, "/cors-test/debug/dbstats", "", nil)
+	if debug.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("debug endpoint got CORS headers: %v", debug.Header())
+	}
+}
+
+func TestCORSDoesNotDuplicateContentType(t *testing.T) {
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	w := serve(corsMiddleware(http.HandlerFunc(handleBook)), http.MethodGet, "/api/books/1", "", nil)
+	if got := w.Header().Values("Content-Type"); len(got) != 1 || got[0] != "application/json" {
+		t.Fatalf("Content-Type = %v", got)
+	}
+}
+
+func TestBodylessResponsesHaveNoContentType(t *testing.T) {
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	w := serve(corsMiddleware(http.HandlerFunc(handleBook)), http.MethodDelete, "/api/books/1", "", nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Fatalf("got %d %q with Content-Type %q", w.Code, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+	created := serve(corsMiddleware(http.HandlerFunc(handleBooks)), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert"}`, nil)
+	if created.Code != http.StatusCreated || created.Header().Get("Content-Type") != "" {
+		t.Fatalf("got %d with Content-Type %q", created.Code, created.Header().Get("Content-Type"))
+	}
+}
+
+func gzipped(t *testing.T, body string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.String()
+}
+
+var gzipHeader = map[string]string{"Content-Encoding": "gzip", "Content-Type": "application/json"}
+
+func TestGzipRequestBodyIsDecoded(t *testing.T) {
+	store := &insertStore{nextID: 2}
+	useFakeDB(t, store.handle)
+	body := gzipped(t, `{"bookname":"Dune","author":"Frank Herbert"}`)
+	w := serve(gzipRequestMiddleware(http.HandlerFunc(handleBooks)), http.MethodPost, "/api/books", body, gzipHeader)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if len(store.books) != 1 || store.books[0].BookName != "Dune" || store.books[0].Author != "Frank Herbert" {
+		t.Errorf("stored = %+v", store.books)
+	}
+}
+
+func TestMalformedGzipIs400(t *testing.T) {
+	w := serve(gzipRequestMiddleware(http.HandlerFunc(echoHandler)), http.MethodPost, "/api/books", "not gzip at all", gzipHeader)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "malformed gzip request body") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGzipBodyIsCappedAfterDecompression(t *testing.T) {
+	setForTest(t, &maxDecompressedBody, 16)
+	w := serve(gzipRequestMiddleware(http.HandlerFunc(echoHandler)), http.MethodPost, "/api/books", gzipped(t, strings.Repeat("a", 1024)), gzipHeader)
+	if w.Code != http.StatusBadRequest || strings.HasPrefix(w.Body.String(), "echo:") {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestPlainBodyPassesThrough(t *testing.T) {
+	w := serve(gzipRequestMiddleware(http.HandlerFunc(echoHandler)), http.MethodPost, "/api/books", "plain", nil)
+	if w.Body.String() != "echo:plain" {
+		t.Fatalf("body = %q", w.Body.String())
+	}
+}
+
+func TestCORSCanBeDisabled(t *testing.T) {
+	setForTest(t, &corsEnabled, false)
+	w := serve(corsMiddleware(http.HandlerFunc(echoHandler)), http.MethodGet, "/api/books", "", map[string]string{"Origin": "https://app.example"})
+	for _, header := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers", "Access-Control-Expose-Headers"} {
+		if got := w.Header().Get(header); got != "" {
+			t.Errorf("%s = %q with CORS disabled", header, got)
+		}
+	}
+	if w.Body.String() != "echo:" {
+		t.Errorf("handler did not run: %q", w.Body.String())
+	}
+}
+
+func TestCORSEnabledByDefault(t *testing.T) {
+	w := serve(corsMiddleware(http.HandlerFunc(echoHandler)), http.MethodGet, "/api/books", "", nil)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("headers = %v", w.Header())
+	}
+}
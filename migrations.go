@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var uniqueTitles = getEnvBool("UNIQUE_TITLES", false)
+
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS {books} (
+		bookid INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		bookname VARCHAR(255) NOT NULL,
+		author VARCHAR(255) NOT NULL,
+		genre VARCHAR(255),
+		publisher VARCHAR(255)
+	)`,
+	`ALTER TABLE {books} ADD COLUMN cover_url VARCHAR(2048) NOT NULL DEFAULT ''`,
+	`ALTER TABLE {books} ADD COLUMN shelf VARCHAR(64) NOT NULL DEFAULT '', ADD COLUMN position INT NOT NULL DEFAULT 0`,
+	`ALTER TABLE {books} ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'published'`,
+	`ALTER TABLE {books} ALTER COLUMN status SET DEFAULT 'draft'`,
+	`ALTER TABLE {books} ADD COLUMN deleted_at DATETIME NULL, ADD INDEX idx_{books}_deleted_at (deleted_at)`,
+	`ALTER TABLE {books}
+		ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		ADD INDEX idx_{books}_updated_at (updated_at)`,
+	`ALTER TABLE {books} ADD COLUMN language CHAR(2) NOT NULL DEFAULT '', ADD INDEX idx_{books}_language (language)`,
+	`CREATE TABLE IF NOT EXISTS {books}_audit (
+		id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		bookid INT NOT NULL,
+		action VARCHAR(16) NOT NULL,
+		actor VARCHAR(255) NOT NULL,
+		old_value JSON NULL,
+		new_value JSON NULL,
+		created_at TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+		INDEX idx_{books}_audit_bookid (bookid, id)
+	)`,
+	`ALTER TABLE {books} ADD COLUMN live_title TINYINT AS (IF(deleted_at IS NULL, 1, NULL)) VIRTUAL`,
+	`ALTER TABLE {books} ADD COLUMN stock INT NOT NULL DEFAULT 0`,
+	`CREATE TABLE IF NOT EXISTS {books}_tags (
+		id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(64) NOT NULL,
+		UNIQUE INDEX uq_{books}_tags_name (name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS {books}_book_tags (
+		bookid INT NOT NULL,
+		tag_id INT NOT NULL,
+		PRIMARY KEY (bookid, tag_id),
+		INDEX idx_{books}_book_tags_tag_id (tag_id, bookid)
+	)`,
+	`ALTER TABLE {books} ADD COLUMN isbn VARCHAR(13) NOT NULL DEFAULT '', ADD INDEX idx_{books}_isbn (isbn)`,
+}
+
+func migrationSQL(statement string) string {
+	return strings.ReplaceAll(statement, "{books}", booksTable)
+}
+
+func runMigrations() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := execContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		table_name VARCHAR(64) NOT NULL,
+		version INT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (table_name, version)
+	)`)
+	if err != nil {
+		return err
+	}
+	var current int
+	err = queryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations WHERE table_name = ?`, booksTable).Scan(&current)
+	if err != nil {
+		return err
+	}
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		log.Printf("applying migration %d to %s", version, booksTable)
+		if _, err := execContext(ctx, migrationSQL(migrations[i])); err != nil {
+			return err
+		}
+		_, err := execContext(ctx, `INSERT INTO schema_migrations (table_name, version) VALUES (?, ?)`, booksTable, version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uniqueTitleIndex() string {
+	return fmt.Sprintf("uq_%s_bookname_author", booksTable)
+}
+
+// ensureUniqueTitleIndex adds the UNIQUE_TITLES index on bookname and author.
+// live_title is NULL for soft-deleted rows, so they never collide.
+func ensureUniqueTitleIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var count int
+	err := queryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`, booksTable, uniqueTitleIndex()).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	log.Printf("adding %s to %s", uniqueTitleIndex(), booksTable)
+	_, err = execContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD UNIQUE INDEX %s (bookname, author, live_title)`, booksTable, uniqueTitleIndex()))
+	if mysqlErrorNumber(err) == mysqlErrDuplicateEntry {
+		return fmt.Errorf("cannot enable UNIQUE_TITLES: %s has live books sharing a bookname and author, merge or delete them first", booksTable)
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	namingLower = "lower"
+	namingSnake = "snake"
+	namingCamel = "camel"
+)
+
+var (
+	jsonNaming    = strings.ToLower(getEnv("JSON_NAMING", namingLower))
+	snakeBookKeys = map[string]string{"bookid": "book_id", "bookname": "book_name"}
+)
+
+func snakeKey(column string) string {
+	if key, ok := snakeBookKeys[column]; ok {
+		return key
+	}
+	return column
+}
+
+func camelKey(snake string) string {
+	parts := strings.Split(snake, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func jsonKey(column string) string {
+	switch jsonNaming {
+	case namingSnake:
+		return snakeKey(column)
+	case namingCamel:
+		return camelKey(snakeKey(column))
+	default:
+		return column
+	}
+}
+
+func jsonKeys(columns []string) []string {
+	keys := make([]string, len(columns))
+	for i, column := range columns {
+		keys[i] = jsonKey(column)
+	}
+	return keys
+}
+
+func renameBookKeys(data []byte) ([]byte, error) {
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil || document == nil {
+		return data, err
+	}
+	renamed := make(map[string]json.RawMessage, len(document))
+	for key, value := range document {
+		for _, column := range bookColumnNames {
+			if jsonKey(column) == key {
+				key = column
+				break
+			}
+		}
+		renamed[key] = value
+	}
+	return json.Marshal(renamed)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestJSONNamingModes(t *testing.T) {
+	cases := []struct {
+		mode, prefix string
+		keys         []string
+	}{
+		{namingLower, `{"bookid":1,"bookname":"Dune",`, []string{`"cover_url":`, `"created_at":`, `"updated_at":`}},
+		{namingSnake, `{"book_id":1,"book_name":"Dune",`, []string{`"cover_url":`, `"created_at":`, `"updated_at":`}},
+		{namingCamel, `{"bookId":1,"bookName":"Dune",`, []string{`"coverUrl":`, `"createdAt":`, `"updatedAt":`}},
+	}
+	for _, c := range cases {
+		t.Run(c.mode, func(t *testing.T) {
+			setForTest(t, &jsonNaming, c.mode)
+			useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+			body := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil).Body.String()
+			if !strings.HasPrefix(body, c.prefix) {
+				t.Errorf("book = %s", body)
+			}
+			for _, key := range c.keys {
+				if !strings.Contains(body, key) {
+					t.Errorf("book is missing %s: %s", key, body)
+				}
+			}
+			useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+				return selectedRows(query, testBook(1, "Dune"))
+			})
+			projected := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?fields=bookid,bookname", "", nil).Body.String()
+			if want := "[" + strings.TrimSuffix(c.prefix, ",") + "}]\n"; projected != want {
+				t.Errorf("projected = %s, want %s", projected, want)
+			}
+		})
+	}
+}
+
+func TestJSONNamingAcceptsConfiguredKeys(t *testing.T) {
+	setForTest(t, &jsonNaming, namingCamel)
+	var book Book
+	if err := json.Unmarshal([]byte(`{"bookId":"7","bookName":"Dune","author":"Frank Herbert","coverUrl":"https://example.com/dune.jpg"}`), &book); err != nil {
+		t.Fatal(err)
+	}
+	if book.BookID != 7 || book.BookName != "Dune" || book.CoverURL != "https://example.com/dune.jpg" {
+		t.Errorf("book = %+v", book)
+	}
+	data, err := json.Marshal(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Book
+	if err := json.Unmarshal(data, &back); err != nil || back.BookID != 7 || back.CoverURL != book.CoverURL {
+		t.Errorf("round trip = %+v (%v) from %s", back, err, data)
+	}
+}
+
+func TestSetupDBRejectsUnknownJSONNaming(t *testing.T) {
+	setForTest(t, &jsonNaming, "kebab")
+	if err := SetupDB(); err == nil || !strings.Contains(err.Error(), "JSON_NAMING") {
+		t.Fatalf("err = %v", err)
+	}
+}
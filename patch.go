@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const jsonPatchMediaType = "application/json-patch+json"
+
+var patchableFields = []string{"bookname", "author", "genre", "publisher", "cover_url", "shelf", "position", "status", "language", "stock", "isbn"}
+
+var errPatchTestFailed = errors.New("json patch test operation failed")
+
+type patchError struct {
+	status int
+	err    error
+}
+
+func (e *patchError) Error() string {
+	return e.err.Error()
+}
+
+func (e *patchError) Unwrap() error {
+	return e.err
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+func patchFieldName(path string) (string, error) {
+	field := strings.TrimPrefix(path, "/")
+	if field == path || strings.Contains(field, "/") {
+		return "", fmt.Errorf("unsupported patch path %q", path)
+	}
+	for _, f := range patchableFields {
+		if f == field {
+			return field, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported patch path %q", path)
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var av, bv interface{}
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func applyJSONPatch(book Book, operations []patchOperation) (Book, error) {
+	j, err := json.Marshal(canonicalBook(book))
+	if err != nil {
+		return book, err
+	}
+	document := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(j, &document); err != nil {
+		return book, err
+	}
+	for _, operation := range operations {
+		field, err := patchFieldName(operation.Path)
+		if err != nil {
+			return book, err
+		}
+		if len(operation.Value) == 0 {
+			return book, fmt.Errorf("patch operation on %q requires a value", operation.Path)
+		}
+		switch operation.Op {
+		case "replace":
+			document[field] = operation.Value
+		case "test":
+			if !jsonEqual(document[field], operation.Value) {
+				return book, fmt.Errorf("%w: %s", errPatchTestFailed, operation.Path)
+			}
+		default:
+			return book, fmt.Errorf("unsupported patch op %q", operation.Op)
+		}
+	}
+	j, err = json.Marshal(document)
+	if err != nil {
+		return book, err
+	}
+	var patched Book
+	if err := json.Unmarshal(j, &patched); err != nil {
+		return book, err
+	}
+	return patched, nil
+}
+
+func patchBook(bookID int, operations []patchOperation, actor string) (*Book, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	var patched *Book
+	err = retryWrites(ctx, func() error {
+		tx, err := beginTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer rollbackTx(tx)
+		patched = nil
+		book, err := getBookTx(ctx, tx, bookID)
+		if err != nil || book == nil {
+			return err
+		}
+		result, err := applyJSONPatch(*book, operations)
+		if errors.Is(err, errPatchTestFailed) {
+			return &patchError{status: http.StatusConflict, err: err}
+		}
+		if err != nil {
+			return &patchError{status: http.StatusBadRequest, err: err}
+		}
+		if errs := validateBook(result); len(errs) > 0 {
+			return &patchError{status: validationStatus(), err: errors.New(strings.Join(errs, "; "))}
+		}
+		query, args := updateBookStatement(result)
+		if _, err := auditedExecTx(ctx, tx, actor, auditUpdate, bookID, query, args...); err != nil {
+			return err
+		}
+		if err := commitTx(tx); err != nil {
+			return err
+		}
+		patched = &result
+		return nil
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	if patched != nil {
+		publishBookChange(auditUpdate, bookID)
+	}
+	return patched, nil
+}
+
+func handleBookPatch(w http.ResponseWriter, r *http.Request, bookID int) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		handleBookIncrement(w, r, bookID)
+		return
+	}
+	if mediaType != jsonPatchMediaType {
+		writeError(w, r, http.StatusUnsupportedMediaType, "PATCH requires Content-Type "+jsonPatchMediaType+" or application/json")
+		return
+	}
+	var operations []patchOperation
+	err := decodeJSON(r.Body, &operations)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid patch payload: "+err.Error())
+		return
+	}
+	patched, err := patchBook(bookID, operations, requestActor(r))
+	var rejected *patchError
+	if errors.As(err, &rejected) {
+		writeError(w, r, rejected.status, rejected.Error())
+		return
+	}
+	if err != nil {
+		writeDBError(w, r, err, "could not update book")
+		return
+	}
+	if patched == nil {
+		writeError(w, r, http.StatusNotFound, "book not found")
+		return
+	}
+	warnUnknownPublisher(w, patched.Publisher)
+	writeJSON(w, r, http.StatusOK, visibleBook(r, patched))
+}
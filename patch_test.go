@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var jsonPatchHeader = map[string]string{"Content-Type": jsonPatchMediaType}
+
+func TestJSONPatchReplaceAuthor(t *testing.T) {
+	fake := useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	body := `[{"op":"test","path":"/author","value":"Alan Donovan"},{"op":"replace","path":"/author","value":"Frank Herbert"}]`
+	w := serve(http.HandlerFunc(handleBook), http.MethodPatch, "/api/books/1", body, jsonPatchHeader)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var book Book
+	if err := json.Unmarshal(w.Body.Bytes(), &book); err != nil {
+		t.Fatal(err)
+	}
+	if book.Author != "Frank Herbert" || book.BookName != "Dune" {
+		t.Errorf("book = %+v", book)
+	}
+	update, ok := fake.find("UPDATE books SET bookname = ?")
+	if !ok || update.args[1] != "Frank Herbert" || update.args[11] != int64(1) {
+		t.Fatalf("update = %+v", update)
+	}
+	queries := fake.queries()
+	if !strings.HasSuffix(queries[0], "FOR UPDATE") {
+		t.Errorf("book was not locked before patching: %v", queries)
+	}
+	if fake.commits != 1 {
+		t.Errorf("commits = %d, want the read and write in one transaction", fake.commits)
+	}
+}
+
+func TestJSONPatchFailedTestIsConflict(t *testing.T) {
+	fake := useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	body := `[{"op":"test","path":"/author","value":"Someone Else"},{"op":"replace","path":"/author","value":"Frank Herbert"}]`
+	w := serve(http.HandlerFunc(handleBook), http.MethodPatch, "/api/books/1", body, jsonPatchHeader)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body.String())
+	}
+	if _, ok := fake.find("UPDATE books SET"); ok {
+		t.Error("failed test operation still updated the book")
+	}
+	if fake.commits != 0 {
+		t.Errorf("commits = %d", fake.commits)
+	}
+}
+
+func TestJSONPatchRejectsUnsupportedPath(t *testing.T) {
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	for _, body := range []string{
+		`[{"op":"replace","path":"/bookid","value":2}]`,
+		`[{"op":"replace","path":"/author/first","value":"x"}]`,
+		`[{"op":"remove","path":"/author"}]`,
+	} {
+		w := serve(http.HandlerFunc(handleBook), http.MethodPatch, "/api/books/1", body, jsonPatchHeader)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestJSONPatchMissingBook(t *testing.T) {
+	useFakeDB(t, bookStore(nil, 0))
+	w := serve(http.HandlerFunc(handleBook), http.MethodPatch, "/api/books/1", `[{"op":"replace","path":"/author","value":"x"}]`, jsonPatchHeader)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestPatchRequiresSupportedMediaType(t *testing.T) {
+	w := serve(http.HandlerFunc(handleBook), http.MethodPatch, "/api/books/1", `[]`, map[string]string{"Content-Type": "text/plain"})
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+type postmanCollection struct {
+	Info     postmanInfo       `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable"`
+}
+
+type postmanInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Schema      string `json:"schema"`
+}
+
+type postmanVariable struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+type postmanItem struct {
+	Name    string         `json:"name"`
+	Request postmanRequest `json:"request"`
+}
+
+type postmanRequest struct {
+	Method string          `json:"method"`
+	Header []postmanHeader `json:"header"`
+	Body   *postmanBody    `json:"body,omitempty"`
+	URL    postmanURL      `json:"url"`
+}
+
+type postmanHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type postmanBody struct {
+	Mode     string             `json:"mode"`
+	Raw      string             `json:"raw,omitempty"`
+	Formdata []postmanFormField `json:"formdata,omitempty"`
+}
+
+type postmanFormField struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	Src  string `json:"src"`
+}
+
+type postmanURL struct {
+	Raw   string            `json:"raw"`
+	Host  []string          `json:"host"`
+	Path  []string          `json:"path"`
+	Query []postmanVariable `json:"query,omitempty"`
+}
+
+func postmanRequestURL(path string) postmanURL {
+	path, rawQuery, _ := strings.Cut(path, "?")
+	url := postmanURL{Raw: "{{baseUrl}}" + path, Host: []string{"{{baseUrl}}"}, Path: strings.Split(strings.Trim(path, "/"), "/")}
+	if rawQuery != "" {
+		url.Raw += "?" + rawQuery
+		for _, pair := range strings.Split(rawQuery, "&") {
+			key, value, _ := strings.Cut(pair, "=")
+			url.Query = append(url.Query, postmanVariable{Key: key, Value: value, Description: queryParamDescription(key)})
+		}
+	}
+	return url
+}
+
+func postmanItemFor(basePath string, example routeExample) postmanItem {
+	request := postmanRequest{Method: example.method, Header: []postmanHeader{}, URL: postmanRequestURL(basePath + example.path)}
+	keys := make([]string, 0, len(example.headers))
+	for key := range example.headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		request.Header = append(request.Header, postmanHeader{Key: key, Value: example.headers[key]})
+	}
+	if example.body != "" {
+		request.Body = &postmanBody{Mode: "raw", Raw: example.body}
+	}
+	if example.file != "" {
+		request.Body = &postmanBody{Mode: "formdata", Formdata: []postmanFormField{{Key: example.file, Type: "file", Src: "books.csv"}}}
+	}
+	return postmanItem{Name: example.name, Request: request}
+}
+
+func postmanDescription() string {
+	return fmt.Sprintf("List filters that may be repeated: %s. Parameters that must appear at most once: %s.",
+		strings.Join(repeatableFilterParams, ", "), strings.Join(singleValueParams, ", "))
+}
+
+func buildPostmanCollection(basePath, baseURL string, routes []apiRoute) postmanCollection {
+	collection := postmanCollection{
+		Info:     postmanInfo{Name: "Book API", Description: postmanDescription(), Schema: postmanSchema},
+		Item:     []postmanItem{},
+		Variable: []postmanVariable{{Key: "baseUrl", Value: baseURL}, {Key: "trackingId", Value: ""}},
+	}
+	for _, route := range routes {
+		for _, example := range route.examples {
+			collection.Item = append(collection.Item, postmanItemFor(basePath, example))
+		}
+	}
+	return collection
+}
+
+func handlePostmanCollection(basePath string, routes []apiRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			writeJSONWithETag(w, r, buildPostmanCollection(basePath, scheme+"://"+r.Host, routes))
+		case http.MethodOptions:
+			return
+		default:
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostmanCollectionListsBookRequests(t *testing.T) {
+	w := serve(handlePostmanCollection("/api", bookRoutes()), http.MethodGet, "/api/postman.json", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var collection postmanCollection
+	if err := json.Unmarshal(w.Body.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+	if collection.Info.Schema != postmanSchema || collection.Variable[0].Value != "http://example.com" {
+		t.Errorf("info = %+v, variables = %+v", collection.Info, collection.Variable)
+	}
+	items := make(map[string]postmanItem)
+	for _, item := range collection.Item {
+		items[item.Name] = item
+	}
+	list, ok := items["List books"]
+	if !ok || list.Request.Method != http.MethodGet || list.Request.URL.Raw != "{{baseUrl}}/api/books?status=published&sort=bookname" {
+		t.Errorf("list request = %+v", list)
+	}
+	if len(list.Request.URL.Query) != 2 || list.Request.URL.Query[0].Key != "status" {
+		t.Errorf("list query = %+v", list.Request.URL.Query)
+	}
+	create, ok := items["Create book"]
+	if !ok || create.Request.Method != http.MethodPost || create.Request.Body == nil || create.Request.Body.Raw != exampleBook {
+		t.Fatalf("create request = %+v", create)
+	}
+	var book Book
+	if err := json.Unmarshal([]byte(create.Request.Body.Raw), &book); err != nil {
+		t.Errorf("create body does not decode: %v", err)
+	}
+}
+
+func TestPostmanExamplesMatchRegisteredRoutes(t *testing.T) {
+	mux := routesMux()
+	for _, route := range bookRoutes() {
+		for _, example := range route.examples {
+			_, pattern := mux.Handler(httptest.NewRequest(example.method, "/api"+example.path, nil))
+			if pattern != "/api"+route.pattern {
+				t.Errorf("%s %s routes to %q, want %q", example.method, example.path, pattern, "/api"+route.pattern)
+			}
+		}
+	}
+}
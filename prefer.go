@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	preferRepresentation = "representation"
+	preferMinimal        = "minimal"
+)
+
+func preferredReturn(r *http.Request) string {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			token := strings.TrimSpace(strings.SplitN(preference, ";", 2)[0])
+			name, value, ok := strings.Cut(token, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), "return") {
+				continue
+			}
+			value = strings.ToLower(strings.Trim(strings.TrimSpace(value), `"`))
+			if value == preferRepresentation || value == preferMinimal {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+func applyPreferReturn(w http.ResponseWriter, r *http.Request) string {
+	preference := preferredReturn(r)
+	if preference != "" {
+		w.Header().Set("Preference-Applied", "return="+preference)
+	}
+	return preference
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreferRepresentationReturnsCreatedBook(t *testing.T) {
+	store := &insertStore{nextID: 41}
+	useFakeDB(t, store.handle)
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert"}`, map[string]string{"Prefer": "return=representation"})
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/books/42" {
+		t.Fatalf("got %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Preference-Applied") != "return=representation" {
+		t.Errorf("Preference-Applied = %q", w.Header().Get("Preference-Applied"))
+	}
+	var created Book
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.BookID != 42 || created.BookName != "Dune" {
+		t.Errorf("body = %s (%v)", w.Body.String(), err)
+	}
+}
+
+func TestPreferMinimalSkipsBodyAndReadBack(t *testing.T) {
+	setForTest(t, &confirmInserts, true)
+	store := &insertStore{nextID: 41}
+	fake := useFakeDB(t, store.handle)
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert"}`, map[string]string{"Prefer": "return=minimal"})
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/books/42" {
+		t.Fatalf("got %d %v", w.Code, w.Header())
+	}
+	if w.Body.Len() != 0 || w.Header().Get("Preference-Applied") != "return=minimal" {
+		t.Errorf("body = %q, Preference-Applied = %q", w.Body.String(), w.Header().Get("Preference-Applied"))
+	}
+	for _, query := range fake.queries() {
+		if strings.HasPrefix(query, "SELECT") && !strings.HasSuffix(query, "FOR UPDATE") {
+			t.Errorf("minimal response still read the book back: %q", query)
+		}
+	}
+}
+
+func TestPreferMinimalOnPut(t *testing.T) {
+	useFakeDB(t, keyedStore(map[int]Book{}))
+	w := serve(http.HandlerFunc(handleBook), http.MethodPut, "/api/books/77", `{"bookname":"Dune","author":"Frank Herbert"}`, map[string]string{"If-None-Match": "*", "Prefer": "return=minimal"})
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/books/77" || w.Body.Len() != 0 {
+		t.Fatalf("got %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+}
+
+func TestPreferredReturnParsing(t *testing.T) {
+	cases := map[string]string{
+		"":                                "",
+		"return=minimal":                  preferMinimal,
+		`respond-async, Return="Minimal"`: preferMinimal,
+		"return=representation; foo=bar":  preferRepresentation,
+		"return=headers-only":             "",
+		"wait=10":                         "",
+	}
+	for header, want := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/api/books", nil)
+		if header != "" {
+			r.Header.Set("Prefer", header)
+		}
+		if got := preferredReturn(r); got != want {
+			t.Errorf("Prefer %q: got %q, want %q", header, got, want)
+		}
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/books", strings.NewReader(""))
+	r.Header.Add("Prefer", "wait=10")
+	r.Header.Add("Prefer", "return=representation")
+	if got := preferredReturn(r); got != preferRepresentation {
+		t.Errorf("repeated Prefer headers: got %q", got)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	softDelete          = getEnvBool("SOFT_DELETE", false)
+	softDeleteRetention = getEnvDuration("SOFT_DELETE_RETENTION", 30*24*time.Hour)
+	pruneInterval       = getEnvDuration("PRUNE_INTERVAL", time.Hour)
+)
+
+func pruneSoftDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	result, err := execContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE deleted_at IS NOT NULL AND deleted_at < NOW() - INTERVAL ? SECOND`, booksTable), int64(retention.Seconds()))
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func runPruneLoop(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := pruneSoftDeleted(ctx, retention)
+			if err != nil {
+				continue
+			}
+			log.Printf("pruned %d soft-deleted books", pruned)
+		}
+	}
+}
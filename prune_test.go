@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPruneSoftDeletedRemovesOnlyExpiredRows(t *testing.T) {
+	now := time.Now()
+	deletedAt := map[int]time.Time{1: now.Add(-40 * 24 * time.Hour), 2: now.Add(-24 * time.Hour), 3: {}}
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if !strings.HasPrefix(query, "DELETE FROM books WHERE deleted_at IS NOT NULL AND deleted_at < NOW() - INTERVAL ? SECOND") {
+			return fakeResult{}
+		}
+		cutoff := now.Add(-time.Duration(args[0].(int64)) * time.Second)
+		var pruned int64
+		for id, at := range deletedAt {
+			if !at.IsZero() && at.Before(cutoff) {
+				delete(deletedAt, id)
+				pruned++
+			}
+		}
+		return fakeResult{affected: pruned}
+	})
+	pruned, err := pruneSoftDeleted(context.Background(), 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Errorf("pruned = %d, want 1", pruned)
+	}
+	if _, ok := deletedAt[1]; ok {
+		t.Error("expired soft-deleted row was kept")
+	}
+	if _, ok := deletedAt[2]; !ok {
+		t.Error("recently soft-deleted row was pruned")
+	}
+	if _, ok := deletedAt[3]; !ok {
+		t.Error("live row was pruned")
+	}
+	if len(fake.queries()) != 1 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
+
+func TestPruneLoopStopsOnCancel(t *testing.T) {
+	fake := useFakeDB(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runPruneLoop(ctx, 5*time.Millisecond, time.Hour)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for len(fake.queries()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("prune loop did not stop after cancel")
+	}
+	if len(fake.queries()) == 0 {
+		t.Error("prune loop never ran")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	publisherCheckOff    = "off"
+	publisherCheckWarn   = "warn"
+	publisherCheckStrict = "strict"
+)
+
+const (
+	defaultPublisherBooksLimit = 50
+	maxPublisherBooksLimit     = 200
+)
+
+var (
+	publisherCheckMode = strings.ToLower(getEnv("PUBLISHER_VALIDATION", publisherCheckOff))
+	knownPublishers    = parsePublisherList(getEnv("PUBLISHER_ALLOWLIST", ""))
+)
+
+func parsePublisherList(value string) map[string]bool {
+	publishers := make(map[string]bool)
+	for _, publisher := range strings.Split(value, ",") {
+		if publisher = strings.TrimSpace(publisher); publisher != "" {
+			publishers[strings.ToLower(publisher)] = true
+		}
+	}
+	return publishers
+}
+
+func isKnownPublisher(publisher string) bool {
+	return knownPublishers[strings.ToLower(strings.TrimSpace(publisher))]
+}
+
+func validatePublisher(publisher string) []string {
+	if publisherCheckMode != publisherCheckStrict || isKnownPublisher(publisher) {
+		return nil
+	}
+	return []string{fmt.Sprintf("publisher %q is not in the allow-list", publisher)}
+}
+
+func warnUnknownPublisher(w http.ResponseWriter, publisher string) {
+	if publisherCheckMode != publisherCheckWarn || isKnownPublisher(publisher) {
+		return
+	}
+	message := fmt.Sprintf("unknown publisher %q", publisher)
+	log.Print(message)
+	w.Header().Add("Warning", fmt.Sprintf("299 - %q", message))
+}
+
+func getBooksByPublisher(filter bookFilter, publisher string, limit, offset int) ([]Book, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	where, args := filter.whereClause()
+	columns := bookColumns
+	if len(filter.Fields) > 0 {
+		columns = strings.Join(filter.Fields, ", ")
+	}
+	query := fmt.Sprintf(`SELECT %s FROM %s%s AND publisher = ?%s LIMIT ? OFFSET ?`, columns, booksTable, where, filter.orderClause())
+	results, err := readQueryContext(ctx, query, append(args, publisher, limit, offset)...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	books := make([]Book, 0)
+	for results.Next() {
+		var book Book
+		if err := scanBookColumns(results, &book, filter.Fields); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, results.Err()
+}
+
+func publisherFromPath(r *http.Request) (string, bool) {
+	_, rest, ok := strings.Cut(r.URL.EscapedPath(), "/publishers/")
+	segment := strings.TrimSuffix(rest, "/books")
+	if !ok || segment == rest || segment == "" || strings.Contains(segment, "/") {
+		return "", false
+	}
+	publisher, err := url.PathUnescape(segment)
+	if err != nil || strings.TrimSpace(publisher) == "" {
+		return "", false
+	}
+	return publisher, true
+}
+
+func parsePageParam(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
+
+func handlePublisherBooks(w http.ResponseWriter, r *http.Request) {
+	publisher, ok := publisherFromPath(r)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		limit, err := parsePageParam(r, "limit", defaultPublisherBooksLimit)
+		if err == nil && limit == 0 {
+			err = fmt.Errorf("limit must be a positive integer")
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if limit > maxPublisherBooksLimit {
+			limit = maxPublisherBooksLimit
+		}
+		offset, err := parsePageParam(r, "offset", 0)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter, err := parseBookFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !authorizeStatus(w, r) {
+			return
+		}
+		filter.Fields = visibleFields(r, filter.Fields)
+		books, err := getBooksByPublisher(filter, publisher, limit, offset)
+		if err != nil {
+			writeDBError(w, r, err, "could not list books")
+			return
+		}
+		if len(filter.Fields) > 0 {
+			writeJSONWithETag(w, r, projectBooks(books, filter.Fields))
+			return
+		}
+		writeJSONWithETag(w, r, books)
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
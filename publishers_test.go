@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const unknownPublisherBook = `{"bookname":"Dune","author":"Frank Herbert","publisher":"Vanity House"}`
+
+func TestStrictPublisherCheckRejectsUnknown(t *testing.T) {
+	setForTest(t, &publisherCheckMode, publisherCheckStrict)
+	setForTest(t, &validationUnprocessable, false)
+	setForTest(t, &knownPublishers, parsePublisherList("Penguin, Addison-Wesley"))
+	fake := useFakeDB(t, bookStore(nil, 1))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", unknownPublisherBook, nil)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `publisher \"Vanity House\" is not in the allow-list`) {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+	w = serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert","publisher":"penguin"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Errorf("known publisher: status = %d", w.Code)
+	}
+}
+
+func TestWarnPublisherCheckAcceptsUnknown(t *testing.T) {
+	setForTest(t, &publisherCheckMode, publisherCheckWarn)
+	setForTest(t, &knownPublishers, parsePublisherList("Penguin"))
+	useFakeDB(t, bookStore(nil, 1))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", unknownPublisherBook, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Warning"); got != `299 - "unknown publisher \"Vanity House\""` {
+		t.Errorf("Warning = %q", got)
+	}
+}
+
+func TestPublisherCheckOffByDefault(t *testing.T) {
+	setForTest(t, &publisherCheckMode, publisherCheckOff)
+	useFakeDB(t, bookStore(nil, 1))
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", unknownPublisherBook, nil)
+	if w.Code != http.StatusCreated || w.Header().Get("Warning") != "" {
+		t.Fatalf("got %d, Warning %q", w.Code, w.Header().Get("Warning"))
+	}
+}
+
+func TestPublisherBooksListsMatchingBooks(t *testing.T) {
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(testBook(1, "Dune"), testBook(2, "Emma"))
+	})
+	w := serve(http.HandlerFunc(handlePublisherBooks), http.MethodGet, "/api/publishers/Faber%20%2F%20Faber/books?limit=500&offset=10", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var books []Book
+	if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil || len(books) != 2 || books[0].BookID != 1 || books[1].BookID != 2 {
+		t.Errorf("books = %v (%v)", bookIDs(books), err)
+	}
+	list, _ := fake.find("SELECT")
+	if !strings.Contains(list.query, "status = ?") || !strings.Contains(list.query, "AND publisher = ?") {
+		t.Errorf("query = %q", list.query)
+	}
+	n := len(list.args)
+	if list.args[0] != statusPublished || list.args[n-3] != "Faber / Faber" || list.args[n-2] != int64(maxPublisherBooksLimit) || list.args[n-1] != int64(10) {
+		t.Errorf("args = %v", list.args)
+	}
+}
+
+func TestPublisherBooksEmptyIsArray(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows()
+	})
+	w := serve(http.HandlerFunc(handlePublisherBooks), http.MethodGet, "/api/publishers/Nobody/books", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "[]\n" {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestPublisherBooksRejectsBadPaging(t *testing.T) {
+	fake := useFakeDB(t, nil)
+	for _, target := range []string{"/api/publishers/Penguin/books?limit=0", "/api/publishers/Penguin/books?offset=-1", "/api/publishers/Penguin/books?limit=ten"} {
+		if w := serve(http.HandlerFunc(handlePublisherBooks), http.MethodGet, target, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d", target, w.Code)
+		}
+	}
+	if w := serve(http.HandlerFunc(handlePublisherBooks), http.MethodGet, "/api/publishers//books", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("empty publisher: status = %d", w.Code)
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
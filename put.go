@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func handleBookPut(w http.ResponseWriter, r *http.Request, bookID int) {
+	if strings.TrimSpace(r.Header.Get("If-None-Match")) != "*" {
+		writeError(w, r, http.StatusPreconditionRequired, "PUT only supports create-if-absent with If-None-Match: *, use PATCH to update")
+		return
+	}
+	var book Book
+	if err := decodeJSON(r.Body, &book); err != nil {
+		log.Print(err)
+		writeError(w, r, http.StatusBadRequest, "invalid book payload: "+err.Error())
+		return
+	}
+	if book.BookID != 0 && book.BookID != bookID {
+		writeError(w, r, http.StatusBadRequest, "bookid in the body does not match the URL")
+		return
+	}
+	book.BookID = bookID
+	applyBookDefaults(&book)
+	if errs := validateBook(book); len(errs) > 0 {
+		writeError(w, r, validationStatus(), strings.Join(errs, "; "))
+		return
+	}
+	warnUnknownPublisher(w, book.Publisher)
+	_, err := insertBook(book, requestActor(r))
+	if mysqlErrorNumber(err) == mysqlErrDuplicateEntry && !isDuplicateTitleError(err) {
+		writeError(w, r, http.StatusPreconditionFailed, fmt.Sprintf("book %d already exists", bookID))
+		return
+	}
+	if err != nil {
+		writeDBError(w, r, err, "could not create book")
+		return
+	}
+	if applyPreferReturn(w, r) == preferMinimal {
+		w.Header().Set("Location", r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	created, err := getBookFromPrimary(bookID)
+	if err != nil || created == nil {
+		writeErrorDetail(w, r, http.StatusInternalServerError, "could not read created book", err)
+		return
+	}
+	w.Header().Set("Location", r.URL.Path)
+	writeJSON(w, r, http.StatusCreated, visibleBook(r, created))
+}
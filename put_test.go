@@ -0,0 +1,71 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// keyedStore inserts books under the id the client chose and reports a
+// primary-key collision when that id is taken.
+func keyedStore(books map[int]Book) func(string, []driver.Value) fakeResult {
+	lookup := bookStore(books, 0)
+	return func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "INSERT INTO books (") {
+			id := int(args[0].(int64))
+			if _, ok := books[id]; ok {
+				return fakeResult{err: &mysql.MySQLError{Number: mysqlErrDuplicateEntry, Message: "Duplicate entry for key 'books.PRIMARY'"}}
+			}
+			book := testBook(id, args[1].(string))
+			book.Author = args[2].(string)
+			books[id] = book
+			return fakeResult{lastID: int64(id), affected: 1}
+		}
+		return lookup(query, args)
+	}
+}
+
+var createOnly = map[string]string{"If-None-Match": "*"}
+
+func TestPutCreatesMissingBook(t *testing.T) {
+	books := map[int]Book{}
+	useFakeDB(t, keyedStore(books))
+	w := serve(http.HandlerFunc(handleBook), http.MethodPut, "/api/books/77", `{"bookname":"Dune","author":"Frank Herbert"}`, createOnly)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/api/books/77" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	var created Book
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.BookID != 77 || created.Author != "Frank Herbert" {
+		t.Errorf("body = %s", w.Body.String())
+	}
+	if _, ok := books[77]; !ok {
+		t.Error("book 77 was not stored")
+	}
+}
+
+func TestPutExistingBookIs412(t *testing.T) {
+	books := map[int]Book{77: testBook(77, "Emma")}
+	useFakeDB(t, keyedStore(books))
+	w := serve(http.HandlerFunc(handleBook), http.MethodPut, "/api/books/77", `{"bookname":"Dune","author":"Frank Herbert"}`, createOnly)
+	if w.Code != http.StatusPreconditionFailed || !strings.Contains(w.Body.String(), "book 77 already exists") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if books[77].BookName != "Emma" {
+		t.Errorf("existing book was overwritten: %+v", books[77])
+	}
+}
+
+func TestPutRequiresCreateOnlyPrecondition(t *testing.T) {
+	fake := useFakeDB(t, nil)
+	w := serve(http.HandlerFunc(handleBook), http.MethodPut, "/api/books/77", `{"bookname":"Dune","author":"Frank Herbert"}`, nil)
+	if w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	rateLimitWindow = getEnvDuration("RATE_LIMIT_WINDOW", time.Minute)
+	readLimiter     = newRateLimiter(getEnvInt("RATE_LIMIT_READS", 0), rateLimitWindow)
+	writeLimiter    = newRateLimiter(getEnvInt("RATE_LIMIT_WRITES", 0), rateLimitWindow)
+)
+
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	start  time.Time
+	counts map[string]int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &rateLimiter{limit: limit, window: window, counts: make(map[string]int)}
+}
+
+func (l *rateLimiter) take(key string, now time.Time) (bool, int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if start := now.Truncate(l.window); !start.Equal(l.start) {
+		l.start = start
+		l.counts = make(map[string]int)
+	}
+	reset := l.start.Add(l.window)
+	if l.counts[key] >= l.limit {
+		return false, 0, reset
+	}
+	l.counts[key]++
+	return true, l.limit - l.counts[key], reset
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+func limiterFor(method string) *rateLimiter {
+	if isSafeMethod(method) {
+		return readLimiter
+	}
+	return writeLimiter
+}
+
+func rateLimitMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := limiterFor(r.Method)
+		if limiter == nil || r.Method == http.MethodOptions {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now()
+		allowed, remaining, reset := limiter.take(clientIP(r), now)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limiter.limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if !allowed {
+			setRetryAfter(w, reset.Sub(now))
+			writeError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
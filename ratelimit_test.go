@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReadsDoNotSpendWriteBudget(t *testing.T) {
+	setForTest(t, &readLimiter, newRateLimiter(3, time.Hour))
+	setForTest(t, &writeLimiter, newRateLimiter(1, time.Hour))
+	handler := rateLimitMiddleware(http.HandlerFunc(echoHandler))
+	for i := 0; i < 3; i++ {
+		if w := serve(handler, http.MethodGet, "/api/books", "", nil); w.Code != http.StatusOK {
+			t.Fatalf("read %d: status = %d", i+1, w.Code)
+		}
+	}
+	if w := serve(handler, http.MethodHead, "/api/books", "", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("fourth read: status = %d, want 429", w.Code)
+	}
+	if w := serve(handler, http.MethodPost, "/api/books", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("write after a read flood: status = %d", w.Code)
+	}
+	if w := serve(handler, http.MethodDelete, "/api/books/1", "", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second write: status = %d, want 429", w.Code)
+	}
+}
+
+func TestWritesDoNotSpendReadBudget(t *testing.T) {
+	setForTest(t, &readLimiter, newRateLimiter(1, time.Hour))
+	setForTest(t, &writeLimiter, newRateLimiter(2, time.Hour))
+	handler := rateLimitMiddleware(http.HandlerFunc(echoHandler))
+	for _, method := range []string{http.MethodPost, http.MethodPatch, http.MethodPut} {
+		serve(handler, method, "/api/books/1", "", nil)
+	}
+	if w := serve(handler, http.MethodGet, "/api/books", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("read after a write flood: status = %d", w.Code)
+	}
+}
+
+func TestRateLimitIsPerClient(t *testing.T) {
+	setForTest(t, &readLimiter, newRateLimiter(1, time.Hour))
+	handler := rateLimitMiddleware(http.HandlerFunc(echoHandler))
+	get := func(remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/books", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	if get("192.0.2.1:1000") != http.StatusOK || get("192.0.2.1:2000") != http.StatusTooManyRequests {
+		t.Error("one client was not limited across connections")
+	}
+	if code := get("198.51.100.7:1000"); code != http.StatusOK {
+		t.Errorf("second client: status = %d, want 200", code)
+	}
+}
+
+func TestRateLimitWindowResets(t *testing.T) {
+	limiter := newRateLimiter(1, time.Minute)
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if ok, _, _ := limiter.take("client", start); !ok {
+		t.Fatal("first request was refused")
+	}
+	if ok, _, _ := limiter.take("client", start.Add(59*time.Second)); ok {
+		t.Error("second request in the window was allowed")
+	}
+	if ok, _, _ := limiter.take("client", start.Add(time.Minute)); !ok {
+		t.Error("request in the next window was refused")
+	}
+}
+
+func TestRateLimitOffByDefault(t *testing.T) {
+	if newRateLimiter(0, time.Minute) != nil {
+		t.Fatal("a zero limit should disable the limiter")
+	}
+	setForTest(t, &readLimiter, nil)
+	setForTest(t, &writeLimiter, nil)
+	handler := rateLimitMiddleware(http.HandlerFunc(echoHandler))
+	for i := 0; i < 5; i++ {
+		if w := serve(handler, http.MethodPost, "/api/books", "", nil); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("got %d %v", w.Code, w.Header())
+		}
+	}
+}
+
+func TestRateLimitHeadersCountDown(t *testing.T) {
+	setForTest(t, &readLimiter, newRateLimiter(3, time.Hour))
+	setForTest(t, &writeLimiter, newRateLimiter(5, time.Hour))
+	handler := rateLimitMiddleware(http.HandlerFunc(echoHandler))
+	windowEnd := time.Now().Truncate(time.Hour).Add(time.Hour).Unix()
+	for i, want := range []string{"2", "1", "0"} {
+		w := serve(handler, http.MethodGet, "/api/books", "", nil)
+		if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "3" || w.Header().Get("X-RateLimit-Remaining") != want {
+			t.Fatalf("read %d: %d %v", i+1, w.Code, w.Header())
+		}
+		if w.Header().Get("X-RateLimit-Reset") != strconv.FormatInt(windowEnd, 10) || w.Header().Get("Retry-After") != "" {
+			t.Errorf("read %d: %v", i+1, w.Header())
+		}
+	}
+	w := serve(handler, http.MethodGet, "/api/books", "", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("X-RateLimit-Limit") != "3" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("over the limit: %d %v", w.Code, w.Header())
+	}
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || int64(retryAfter) > windowEnd-time.Now().Unix()+1 {
+		t.Errorf("Retry-After = %q", w.Header().Get("Retry-After"))
+	}
+	if w := serve(handler, http.MethodPost, "/api/books", "", nil); w.Header().Get("X-RateLimit-Limit") != "5" || w.Header().Get("X-RateLimit-Remaining") != "4" {
+		t.Errorf("write headers = %v", w.Header())
+	}
+}
+
+func TestRateLimitHeadersSkipPreflight(t *testing.T) {
+	setForTest(t, &writeLimiter, newRateLimiter(1, time.Hour))
+	handler := rateLimitMiddleware(http.HandlerFunc(echoHandler))
+	for i := 0; i < 3; i++ {
+		if w := serve(handler, http.MethodOptions, "/api/books", "", nil); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Remaining") != "" {
+			t.Fatalf("preflight %d: %d %v", i+1, w.Code, w.Header())
+		}
+	}
+	if w := serve(handler, http.MethodPost, "/api/books", "", nil); w.Code != http.StatusOK {
+		t.Errorf("write after preflights: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var ready atomic.Bool
+
+type readiness struct {
+	Ready bool `json:"ready"`
+}
+
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !ready.Load() {
+			setRetryAfter(w, time.Second)
+			writeJSON(w, r, http.StatusServiceUnavailable, readiness{Ready: false})
+			return
+		}
+		writeJSON(w, r, http.StatusOK, readiness{Ready: true})
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func readinessMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() && !isPreflight(r) {
+			write503(w, r, time.Second, "service is starting up", nil)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// migratedSchema answers the schema_migrations lookup as fully migrated.
+func migratedSchema(query string, args []driver.Value) fakeResult {
+	if strings.HasPrefix(query, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations") {
+		return fakeResult{columns: []string{"version"}, rows: [][]driver.Value{{int64(len(migrations))}}}
+	}
+	return fakeResult{}
+}
+
+func setupFakeDB(t *testing.T, handler func(query string, args []driver.Value) fakeResult) *fakeDB {
+	t.Helper()
+	_, fake := openFakeDB(t, t.Name(), handler)
+	t.Setenv("DB_DSN", t.Name())
+	t.Setenv("DB_REPLICA_DSNS", "")
+	setForTest(t, &dbDriver, "fakedb")
+	previousDB, previousReplicas := Db, readReplicas
+	t.Cleanup(func() {
+		if Db != nil && Db != previousDB {
+			Db.Close()
+		}
+		Db, readReplicas = previousDB, previousReplicas
+		ready.Store(true)
+	})
+	return fake
+}
+
+func TestReadinessFlipsAfterSetup(t *testing.T) {
+	setupFakeDB(t, migratedSchema)
+	ready.Store(false)
+	w := serve(http.HandlerFunc(handleReady), http.MethodGet, "/api/ready", "", nil)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"ready":false`) {
+		t.Fatalf("before setup: %d %s", w.Code, w.Body.String())
+	}
+	gated := readinessMiddleware(http.HandlerFunc(handleBooks))
+	if w := serve(gated, http.MethodGet, "/api/books", "", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("book endpoint before setup: status = %d", w.Code)
+	}
+	if err := SetupDB(); err != nil {
+		t.Fatal(err)
+	}
+	w = serve(http.HandlerFunc(handleReady), http.MethodGet, "/api/ready", "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ready":true`) {
+		t.Fatalf("after setup: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestReadinessStaysFalseWhenMigrationsFail(t *testing.T) {
+	setupFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations") {
+			return fakeResult{err: driver.ErrBadConn}
+		}
+		return migratedSchema(query, args)
+	})
+	ready.Store(false)
+	if err := SetupDB(); err == nil {
+		t.Fatal("expected the migration error")
+	}
+	if ready.Load() {
+		t.Error("ready after a failed setup")
+	}
+}
+
+func TestUniqueTitlesIndexIsOptIn(t *testing.T) {
+	duplicates := false
+	fake := setupFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.Contains(query, "information_schema.statistics"):
+			return fakeResult{columns: []string{"count"}, rows: [][]driver.Value{{int64(0)}}}
+		case strings.HasPrefix(query, "ALTER TABLE books ADD UNIQUE INDEX") && duplicates:
+			return fakeResult{err: &mysql.MySQLError{Number: mysqlErrDuplicateEntry, Message: "Duplicate entry 'Dune-Frank Herbert-1' for key 'books.uq_books_bookname_author'"}}
+		}
+		return migratedSchema(query, args)
+	})
+	if err := SetupDB(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.find("ADD UNIQUE INDEX"); ok {
+		t.Fatal("index added without UNIQUE_TITLES")
+	}
+	setForTest(t, &uniqueTitles, true)
+	if err := SetupDB(); err != nil {
+		t.Fatal(err)
+	}
+	if statement, ok := fake.find("ADD UNIQUE INDEX"); !ok || !strings.HasSuffix(statement.query, "uq_books_bookname_author (bookname, author, live_title)") {
+		t.Errorf("index statement = %+v", statement)
+	}
+	duplicates = true
+	if err := SetupDB(); err == nil || !strings.Contains(err.Error(), "cannot enable UNIQUE_TITLES") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+type recategorizeRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type updatedCount struct {
+	Updated int `json:"updated"`
+}
+
+func recategorizeBooks(from, to, actor string) (int, error) {
+	return auditedBulkUpdate(actor, "genre = ?", []interface{}{to}, "genre = ?", []interface{}{from})
+}
+
+func handleRecategorize(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var request recategorizeRequest
+		err := decodeJSON(r.Body, &request)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid recategorize payload: "+err.Error())
+			return
+		}
+		if strings.TrimSpace(request.From) == "" || strings.TrimSpace(request.To) == "" {
+			writeError(w, r, validationStatus(), "from and to are required")
+			return
+		}
+		updated, err := recategorizeBooks(request.From, request.To, requestActor(r))
+		if err != nil {
+			writeDBError(w, r, err, "could not recategorize books")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, updatedCount{Updated: updated})
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// genreStore keeps books in memory and applies genre renames to them.
+func genreStore(books map[int]Book) func(string, []driver.Value) fakeResult {
+	store := bookStore(books, 0)
+	return func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT "+bookColumns+" FROM books WHERE genre = ?"):
+			var matched []Book
+			for id := 1; id <= len(books); id++ {
+				if books[id].Genre == args[0] {
+					matched = append(matched, books[id])
+				}
+			}
+			return bookRows(matched...)
+		case strings.HasPrefix(query, "UPDATE books SET genre = ? WHERE genre = ?"):
+			var affected int64
+			for id, book := range books {
+				if book.Genre == args[1] {
+					book.Genre = args[0].(string)
+					books[id] = book
+					affected++
+				}
+			}
+			return fakeResult{affected: affected}
+		}
+		return store(query, args)
+	}
+}
+
+func TestRecategorizeUpdatesOnlyMatchingBooks(t *testing.T) {
+	setForTest(t, &apiUsername, "admin")
+	setForTest(t, &apiPassword, "secret")
+	books := map[int]Book{1: testBook(1, "Dune"), 2: testBook(2, "Hyperion"), 3: testBook(3, "Emma")}
+	for _, id := range []int{1, 2} {
+		book := books[id]
+		book.Genre = "Sci-Fi"
+		books[id] = book
+	}
+	fake := useFakeDB(t, genreStore(books))
+	w := serve(requireAuth(handleRecategorize), http.MethodPost, "/api/books/recategorize", `{"from":"Sci-Fi","to":"Science Fiction"}`,
+		map[string]string{"Authorization": "Basic YWRtaW46c2VjcmV0"})
+	if w.Code != http.StatusOK || w.Body.String() != `{"updated":2}`+"\n" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if books[1].Genre != "Science Fiction" || books[2].Genre != "Science Fiction" || books[3].Genre != "Programming" {
+		t.Errorf("genres = %q, %q, %q", books[1].Genre, books[2].Genre, books[3].Genre)
+	}
+	if fake.commits != 1 {
+		t.Errorf("commits = %d", fake.commits)
+	}
+}
+
+func TestRecategorizeRequiresAuth(t *testing.T) {
+	setForTest(t, &apiUsername, "admin")
+	setForTest(t, &apiPassword, "secret")
+	fake := useFakeDB(t, nil)
+	w := serve(requireAuth(handleRecategorize), http.MethodPost, "/api/books/recategorize", `{"from":"Sci-Fi","to":"Science Fiction"}`, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
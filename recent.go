@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultRecentLimit = 10
+	maxRecentLimit     = 50
+)
+
+func getRecentBooks(limit int) ([]Book, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	results, err := readQueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE deleted_at IS NULL AND status = ? ORDER BY created_at DESC, bookid DESC LIMIT ?`, bookColumns, booksTable), statusPublished, limit)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	books := make([]Book, 0, limit)
+	for results.Next() {
+		var book Book
+		if err := scanBook(results, &book); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, results.Err()
+}
+
+func handleRecentBooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limit := defaultRecentLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+		}
+		if limit > maxRecentLimit {
+			limit = maxRecentLimit
+		}
+		books, err := getRecentBooks(limit)
+		if err != nil {
+			writeDBError(w, r, err, "could not list recent books")
+			return
+		}
+		writeJSONWithETag(w, r, visibleBooks(r, books))
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recentStore answers the recent-books query by sorting books the way the
+// ORDER BY asks and applying the LIMIT argument.
+func recentStore(books []Book) func(string, []driver.Value) fakeResult {
+	return func(query string, args []driver.Value) fakeResult {
+		if !strings.Contains(query, "ORDER BY created_at DESC, bookid DESC LIMIT ?") {
+			return fakeResult{}
+		}
+		sorted := append([]Book(nil), books...)
+		sort.Slice(sorted, func(i, j int) bool {
+			if !sorted[i].CreatedAt.Equal(sorted[j].CreatedAt.Time) {
+				return sorted[i].CreatedAt.After(sorted[j].CreatedAt.Time)
+			}
+			return sorted[i].BookID > sorted[j].BookID
+		})
+		if limit := int(args[1].(int64)); len(sorted) > limit {
+			sorted = sorted[:limit]
+		}
+		return bookRows(sorted...)
+	}
+}
+
+func bookIDs(books []Book) []int {
+	ids := make([]int, len(books))
+	for i, book := range books {
+		ids[i] = book.BookID
+	}
+	return ids
+}
+
+func TestRecentBooksNewestFirst(t *testing.T) {
+	var books []Book
+	for id := 1; id <= 4; id++ {
+		book := testBook(id, "Book")
+		book.CreatedAt = Timestamp{testTime.Add(time.Duration(id%3) * time.Hour)}
+		books = append(books, book)
+	}
+	useFakeDB(t, recentStore(books))
+	w := serve(http.HandlerFunc(handleRecentBooks), http.MethodGet, "/api/books/recent?limit=3", "", nil)
+	var recent []Book
+	if err := json.Unmarshal(w.Body.Bytes(), &recent); err != nil {
+		t.Fatalf("%d %s", w.Code, w.Body.String())
+	}
+	if got := bookIDs(recent); len(got) != 3 || got[0] != 2 || got[1] != 4 || got[2] != 1 {
+		t.Errorf("ids = %v, want [2 4 1]", got)
+	}
+}
+
+func TestRecentBooksLimitIsCapped(t *testing.T) {
+	fake := useFakeDB(t, recentStore(nil))
+	serve(http.HandlerFunc(handleRecentBooks), http.MethodGet, "/api/books/recent?limit=500", "", nil)
+	serve(http.HandlerFunc(handleRecentBooks), http.MethodGet, "/api/books/recent", "", nil)
+	queries := fake.statements
+	if len(queries) != 2 || queries[0].args[1] != int64(maxRecentLimit) || queries[1].args[1] != int64(defaultRecentLimit) {
+		t.Fatalf("statements = %+v", queries)
+	}
+	w := serve(http.HandlerFunc(handleRecentBooks), http.MethodGet, "/api/books/recent?limit=0", "", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: status = %d", w.Code)
+	}
+}
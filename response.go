@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var responseEnvelope = getEnvBool("RESPONSE_ENVELOPE", false)
+
+var strictJSON = getEnvBool("STRICT_JSON", false)
+
+var devMode = getEnvBool("DEV_MODE", false)
+
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+type envelope struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data"`
+	Error   *apiError   `json:"error"`
+}
+
+func decodeJSON(body io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(body)
+	if strictJSON {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+func wantsEnvelope(r *http.Request) bool {
+	if responseEnvelope {
+		return true
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && params["profile"] == "envelope" {
+			return true
+		}
+	}
+	return false
+}
+
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func marshalResponse(v interface{}) ([]byte, error) {
+	if value := reflect.ValueOf(v); value.Kind() == reflect.Slice && value.IsNil() {
+		v = reflect.MakeSlice(value.Type(), 0, 0).Interface()
+	}
+	j, err := marshalJSON(v)
+	if err == nil && bytes.Equal(bytes.TrimSpace(j), []byte("null")) {
+		return nil, errors.New("refusing to write a bare null response body")
+	}
+	return j, err
+}
+
+func writeBody(w http.ResponseWriter, status int, v interface{}) {
+	j, err := marshalResponse(v)
+	if err != nil {
+		log.Print(err)
+		status = http.StatusInternalServerError
+		j = []byte(`{"status":500,"message":"could not encode response"}` + "\n")
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(j)))
+	w.WriteHeader(status)
+	_, err = w.Write(j)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func responsePayload(r *http.Request, v interface{}) interface{} {
+	if wantsEnvelope(r) {
+		return envelope{Success: true, Data: v}
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	writeBody(w, status, responsePayload(r, v))
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeAPIError(w, r, &apiError{Status: status, Message: message})
+}
+
+func writeErrorDetail(w http.ResponseWriter, r *http.Request, status int, message string, err error) {
+	log.Printf("%s: %v", message, err)
+	e := &apiError{Status: status, Message: message}
+	if devMode && err != nil {
+		e.Detail = err.Error()
+	}
+	writeAPIError(w, r, e)
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, e *apiError) {
+	status := e.Status
+	if wantsEnvelope(r) {
+		writeBody(w, status, envelope{Success: false, Error: e})
+		return
+	}
+	writeBody(w, status, e)
+}
+
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+func write503(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, message string, err error) {
+	setRetryAfter(w, retryAfter)
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusServiceUnavailable, message, err)
+		return
+	}
+	writeError(w, r, http.StatusServiceUnavailable, message)
+}
+
+func writeDBError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if errors.Is(err, errDBBusy) {
+		write503(w, r, time.Second, "database is busy, retry later", nil)
+		return
+	}
+	if errors.Is(err, errCircuitOpen) {
+		write503(w, r, dbBreaker.cooldown, "database is unavailable, retry later", nil)
+		return
+	}
+	if errors.Is(err, errNoSnapshot) {
+		write503(w, r, 5*time.Second, "database is unavailable", err)
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeErrorDetail(w, r, http.StatusGatewayTimeout, "database query timed out", err)
+		return
+	}
+	if errors.Is(err, errTooManyRows) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("result set exceeds %d rows, narrow the query", maxListRows))
+		return
+	}
+	switch mysqlErrorNumber(err) {
+	case mysqlErrDuplicateEntry:
+		if isDuplicateTitleError(err) {
+			writeError(w, r, http.StatusConflict, "a book with this title by this author already exists")
+			return
+		}
+		writeError(w, r, http.StatusConflict, "a book with this bookid already exists")
+		return
+	case mysqlErrDeadlock:
+		writeErrorDetail(w, r, http.StatusConflict, "write conflicted with a concurrent update, retry the request", err)
+		return
+	case mysqlErrLockWaitTimeout:
+		write503(w, r, time.Second, "timed out waiting for a database lock, retry later", err)
+		return
+	}
+	writeErrorDetail(w, r, http.StatusInternalServerError, message, err)
+}
+
+var callbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+func writeJSONP(w http.ResponseWriter, r *http.Request, callback string, v interface{}) {
+	j, err := marshalResponse(responsePayload(r, v))
+	if err != nil {
+		log.Print(err)
+		writeError(w, r, http.StatusInternalServerError, "could not encode response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	_, err = fmt.Fprintf(w, "/**/%s(%s);", callback, bytes.TrimRight(j, "\n"))
+	if err != nil {
+		log.Print(err)
+	}
+}
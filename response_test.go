@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestRawResponsesByDefault(t *testing.T) {
+	setForTest(t, &responseEnvelope, false)
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil)
+	var book map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &book); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || book["bookname"] != "Dune" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+
+	w = serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/2", "", nil)
+	var e apiError
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotFound || e.Status != http.StatusNotFound || e.Message != "book not found" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+type testEnvelope struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   *apiError       `json:"error"`
+}
+
+func TestEnvelopedResponses(t *testing.T) {
+	setForTest(t, &responseEnvelope, true)
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil)
+	var ok testEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &ok); err != nil {
+		t.Fatal(err)
+	}
+	var book Book
+	if err := json.Unmarshal(ok.Data, &book); err != nil {
+		t.Fatal(err)
+	}
+	if !ok.Success || ok.Error != nil || book.BookName != "Dune" {
+		t.Fatalf("got %s", w.Body.String())
+	}
+
+	w = serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/2", "", nil)
+	var failed testEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &failed); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotFound || failed.Success || string(failed.Data) != "null" || failed.Error == nil || failed.Error.Status != http.StatusNotFound {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestEnvelopeRequestedByAcceptProfile(t *testing.T) {
+	setForTest(t, &responseEnvelope, false)
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/abc", "", map[string]string{"Accept": `application/json; profile="envelope"`})
+	var failed testEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &failed); err != nil {
+		t.Fatal(err)
+	}
+	if failed.Success || failed.Error == nil {
+		t.Fatalf("got %s", w.Body.String())
+	}
+}
+
+func TestTitlesAreNotHTMLEscaped(t *testing.T) {
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Pride & Prejudice <Annotated>")}, 0))
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil)
+	body := w.Body.String()
+	if !strings.Contains(body, `"bookname":"Pride & Prejudice <Annotated>"`) || strings.Contains(body, `\u0026`) {
+		t.Fatalf("body = %s", body)
+	}
+}
+
+func TestJSONPWrapsList(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return bookRows(testBook(1, "Dune"))
+	})
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?callback=widget.render", "", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/javascript" {
+		t.Fatalf("got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "/**/widget.render([{") || !strings.HasSuffix(body, "}]);") {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestJSONPRejectsUnsafeCallback(t *testing.T) {
+	fake := useFakeDB(t, nil)
+	for _, callback := range []string{"alert(1)", "a%3Bb", "1abc", "x%3Cscript%3E"} {
+		w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?callback="+callback, "", nil)
+		if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("callback %q: got %d %q", callback, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+	if len(fake.queries()) != 0 {
+		t.Errorf("queries = %v", fake.queries())
+	}
+}
+
+func failingDB(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{err: errors.New("Table 'bookdb.books' doesn't exist")}
+	})
+}
+
+func TestDevModeIncludesErrorDetail(t *testing.T) {
+	setForTest(t, &devMode, true)
+	failingDB(t)
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil)
+	var e apiError
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusInternalServerError || e.Message != "could not get book" || e.Detail != "Table 'bookdb.books' doesn't exist" {
+		t.Fatalf("got %d %+v", w.Code, e)
+	}
+}
+
+func TestProductionHidesErrorDetail(t *testing.T) {
+	setForTest(t, &devMode, false)
+	failingDB(t)
+	logs := captureLog(t)
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "bookdb") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), "could not get book: Table 'bookdb.books' doesn't exist") {
+		t.Errorf("detail was not logged: %q", logs.String())
+	}
+}
+
+func TestSingleBookHasContentLength(t *testing.T) {
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	w := serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/1", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if got, want := w.Header().Get("Content-Length"), strconv.Itoa(w.Body.Len()); got != want {
+		t.Errorf("Content-Length = %q, want %q", got, want)
+	}
+}
+
+func TestQueryTimeoutIs504(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{err: context.DeadlineExceeded}
+	})
+	for target, handler := range map[string]http.HandlerFunc{"/api/books": handleBooks, "/api/books/1": handleBook} {
+		w := serve(handler, http.MethodGet, target, "", nil)
+		if w.Code != http.StatusGatewayTimeout || !strings.Contains(w.Body.String(), "database query timed out") {
+			t.Errorf("%s: got %d %s", target, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestEvery503CarriesRetryAfter(t *testing.T) {
+	setForTest(t, &dbBreaker, newCircuitBreaker(1, 30*time.Second))
+	paths := map[string]http.HandlerFunc{
+		"db busy":      func(w http.ResponseWriter, r *http.Request) { writeDBError(w, r, errDBBusy, "x") },
+		"breaker open": func(w http.ResponseWriter, r *http.Request) { writeDBError(w, r, errCircuitOpen, "x") },
+		"no snapshot":  func(w http.ResponseWriter, r *http.Request) { writeDBError(w, r, errNoSnapshot, "x") },
+		"lock wait": func(w http.ResponseWriter, r *http.Request) {
+			writeDBError(w, r, &mysql.MySQLError{Number: mysqlErrLockWaitTimeout, Message: "Lock wait timeout exceeded"}, "x")
+		},
+		"not ready": func(w http.ResponseWriter, r *http.Request) {
+			ready.Store(false)
+			readinessMiddleware(http.NotFoundHandler()).ServeHTTP(w, r)
+		},
+		"ready probe": func(w http.ResponseWriter, r *http.Request) { ready.Store(false); handleReady(w, r) },
+		"handler timeout": func(w http.ResponseWriter, r *http.Request) {
+			timeoutResponseWriter{w}.WriteHeader(http.StatusServiceUnavailable)
+		},
+	}
+	t.Cleanup(func() { ready.Store(true) })
+	for name, handler := range paths {
+		w := serve(handler, http.MethodGet, "/api/books", "", nil)
+		seconds, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		if w.Code != http.StatusServiceUnavailable || err != nil || seconds < 1 {
+			t.Errorf("%s: got %d, Retry-After %q", name, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+	w := serve(paths["breaker open"], http.MethodGet, "/api/books", "", nil)
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("breaker Retry-After = %q, want the cooldown", got)
+	}
+	dbBreaker.record(errors.New("dial tcp: connection refused"))
+	w = serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Dune","author":"Frank Herbert"}`, nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("create with breaker open: got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestEmptyTableIsEmptyArray(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult { return bookRows() })
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "[]\n" {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestNoBareNullBodies(t *testing.T) {
+	var books []Book
+	w := serve(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { writeJSON(w, r, http.StatusOK, books) }), http.MethodGet, "/api/books", "", nil)
+	if w.Body.String() != "[]\n" {
+		t.Errorf("nil slice = %q", w.Body.String())
+	}
+	logs := captureLog(t)
+	var book *Book
+	w = serve(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { writeJSON(w, r, http.StatusOK, book) }), http.MethodGet, "/api/books/1", "", nil)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "could not encode response") {
+		t.Errorf("nil book = %d %q", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), "bare null") {
+		t.Errorf("logs = %q", logs.String())
+	}
+	w = serve(http.HandlerFunc(handleBook), http.MethodGet, "/api/books/abc", "", nil)
+	if strings.TrimSpace(w.Body.String()) == "null" || w.Body.Len() == 0 {
+		t.Errorf("error path body = %q", w.Body.String())
+	}
+}
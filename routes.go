@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+)
+
+type routeExample struct {
+	name    string
+	method  string
+	path    string
+	headers map[string]string
+	body    string
+	file    string
+}
+
+type apiRoute struct {
+	pattern  string
+	handler  http.Handler
+	examples []routeExample
+}
+
+const (
+	exampleBook      = `{"bookid":1,"bookname":"The Go Programming Language","author":"Alan Donovan","genre":"Programming","publisher":"Addison-Wesley","status":"published","language":"en","stock":3,"isbn":"9780134190440"}`
+	jsonContentType  = "application/json"
+	booksRoutePrefix = "/" + bookPath
+)
+
+var jsonBody = map[string]string{"Content-Type": jsonContentType}
+
+func bookRoutes() []apiRoute {
+	return []apiRoute{
+		{booksRoutePrefix, bookRoute(handleBooks), []routeExample{
+			{name: "List books", method: http.MethodGet, path: booksRoutePrefix + "?status=published&sort=bookname"},
+			{name: "Create book", method: http.MethodPost, path: booksRoutePrefix, headers: jsonBody, body: exampleBook},
+			{name: "Bulk update books", method: http.MethodPatch, path: booksRoutePrefix + "?genre=Programming", headers: jsonBody, body: `{"status":"published"}`},
+		}},
+		{booksRoutePrefix + "/", bookRoute(handleBook), []routeExample{
+			{name: "Get book", method: http.MethodGet, path: booksRoutePrefix + "/1"},
+			{name: "Create book at id", method: http.MethodPut, path: booksRoutePrefix + "/1", headers: map[string]string{"Content-Type": jsonContentType, "If-None-Match": "*"}, body: exampleBook},
+			{name: "Patch book", method: http.MethodPatch, path: booksRoutePrefix + "/1", headers: map[string]string{"Content-Type": jsonPatchMediaType}, body: `[{"op":"replace","path":"/shelf","value":"A1"}]`},
+			{name: "Increment stock", method: http.MethodPatch, path: booksRoutePrefix + "/1", headers: jsonBody, body: `{"stock":{"$inc":1}}`},
+			{name: "Delete book", method: http.MethodDelete, path: booksRoutePrefix + "/1"},
+			{name: "Copy book", method: http.MethodPost, path: booksRoutePrefix + "/1/copy"},
+			{name: "Move book", method: http.MethodPut, path: booksRoutePrefix + "/1/location", headers: jsonBody, body: `{"shelf":"A1","position":2}`},
+			{name: "Publish book", method: http.MethodPost, path: booksRoutePrefix + "/1/publish"},
+			{name: "Book history", method: http.MethodGet, path: booksRoutePrefix + "/1/history"},
+			{name: "Book tags", method: http.MethodGet, path: booksRoutePrefix + "/1/tags"},
+			{name: "Add book tags", method: http.MethodPost, path: booksRoutePrefix + "/1/tags", headers: jsonBody, body: `{"tags":["classic"]}`},
+		}},
+		{booksRoutePrefix + "/validate", bookRoute(handleValidateBooks), []routeExample{
+			{name: "Validate books", method: http.MethodPost, path: booksRoutePrefix + "/validate", headers: jsonBody, body: "[" + exampleBook + "]"},
+		}},
+		{booksRoutePrefix + "/by-genre", bookRoute(handleBooksByGenre), []routeExample{
+			{name: "Books by genre", method: http.MethodGet, path: booksRoutePrefix + "/by-genre?limit_per_genre=5"},
+		}},
+		{booksRoutePrefix + "/recent", bookRoute(handleRecentBooks), []routeExample{
+			{name: "Recent books", method: http.MethodGet, path: booksRoutePrefix + "/recent?limit=10"},
+		}},
+		{booksRoutePrefix + "/count-by-author", bookRoute(handleCountByAuthor), []routeExample{
+			{name: "Count books by author", method: http.MethodGet, path: booksRoutePrefix + "/count-by-author"},
+		}},
+		{booksRoutePrefix + "/changes", bookRoute(handleBookChanges), []routeExample{
+			{name: "Book changes", method: http.MethodGet, path: booksRoutePrefix + "/changes?since=0&limit=100"},
+		}},
+		{booksRoutePrefix + "/genre-tree", bookRoute(handleGenreTree), []routeExample{
+			{name: "Genre tree", method: http.MethodGet, path: booksRoutePrefix + "/genre-tree"},
+		}},
+		{booksRoutePrefix + "/export", bulkRoute(bulkLimitMiddleware(handleExportBooks)), []routeExample{
+			{name: "Export books", method: http.MethodGet, path: booksRoutePrefix + "/export?format=csv"},
+		}},
+		{booksRoutePrefix + "/import", bulkRoute(bulkLimitMiddleware(handleImportBooks)), []routeExample{
+			{name: "Import books", method: http.MethodPost, path: booksRoutePrefix + "/import", file: "file"},
+		}},
+		{booksRoutePrefix + "/batch-get", bookRoute(handleBatchGetBooks), []routeExample{
+			{name: "Get books by id", method: http.MethodPost, path: booksRoutePrefix + "/batch-get", headers: jsonBody, body: `{"ids":[1,2]}`},
+		}},
+		{booksRoutePrefix + "/queued/", bookRoute(handleQueuedWrite), []routeExample{
+			{name: "Queued write status", method: http.MethodGet, path: booksRoutePrefix + "/queued/{{trackingId}}"},
+		}},
+		{booksRoutePrefix + "/isbn/", bookRoute(handleBookByISBN), []routeExample{
+			{name: "Get book by ISBN", method: http.MethodGet, path: booksRoutePrefix + "/isbn/9780134190440"},
+		}},
+		{booksRoutePrefix + "/recategorize", bookRoute(requireAuth(handleRecategorize)), []routeExample{
+			{name: "Recategorize books", method: http.MethodPost, path: booksRoutePrefix + "/recategorize", headers: jsonBody, body: `{"from":"Sci-Fi","to":"Science Fiction"}`},
+		}},
+		{booksRoutePrefix + "/merge", bookRoute(requireAuth(handleMergeBooks)), []routeExample{
+			{name: "Merge books", method: http.MethodPost, path: booksRoutePrefix + "/merge", headers: jsonBody, body: `{"keep":1,"remove":2}`},
+		}},
+		{booksRoutePrefix + "/events", corsMiddleware(schemaVersionMiddleware(readinessMiddleware(http.HandlerFunc(handleBookEvents)))), []routeExample{
+			{name: "Book events", method: http.MethodGet, path: booksRoutePrefix + "/events", headers: map[string]string{"Accept": "text/event-stream"}},
+		}},
+		{"/search", bookRoute(handleSearch), []routeExample{
+			{name: "Search books", method: http.MethodGet, path: "/search?q=go"},
+		}},
+		{"/publishers/", bookRoute(handlePublisherBooks), []routeExample{
+			{name: "Books by publisher", method: http.MethodGet, path: "/publishers/Addison-Wesley/books?limit=50&offset=0"},
+		}},
+		{"/isbn/validate", corsMiddleware(http.HandlerFunc(handleValidateISBN)), []routeExample{
+			{name: "Validate ISBN", method: http.MethodGet, path: "/isbn/validate?isbn=0-306-40615-2"},
+		}},
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type schemaColumn struct {
+	Name string
+	Type string
+}
+
+var expectedBookSchema = []schemaColumn{
+	{"bookid", "int"},
+	{"bookname", "varchar"},
+	{"author", "varchar"},
+	{"genre", "varchar"},
+	{"publisher", "varchar"},
+	{"cover_url", "varchar"},
+	{"shelf", "varchar"},
+	{"position", "int"},
+	{"status", "varchar"},
+	{"deleted_at", "datetime"},
+	{"created_at", "timestamp"},
+	{"updated_at", "timestamp"},
+	{"language", "char"},
+	{"stock", "int"},
+	{"isbn", "varchar"},
+	{"live_title", "tinyint"},
+}
+
+type schemaMismatch struct {
+	Column   string `json:"column"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Problem  string `json:"problem"`
+}
+
+type schemaReport struct {
+	Table      string           `json:"table"`
+	OK         bool             `json:"ok"`
+	Mismatches []schemaMismatch `json:"mismatches"`
+}
+
+func compareSchema(expected []schemaColumn, actual map[string]string) []schemaMismatch {
+	mismatches := make([]schemaMismatch, 0)
+	for _, column := range expected {
+		actualType, ok := actual[column.Name]
+		if !ok {
+			mismatches = append(mismatches, schemaMismatch{Column: column.Name, Expected: column.Type, Problem: "missing"})
+			continue
+		}
+		if !strings.EqualFold(actualType, column.Type) {
+			mismatches = append(mismatches, schemaMismatch{Column: column.Name, Expected: column.Type, Actual: actualType, Problem: "type mismatch"})
+		}
+	}
+	return mismatches
+}
+
+func getTableColumns(table string) (map[string]string, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	results, err := queryContext(ctx, `SELECT column_name, data_type FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?`, table)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	columns := make(map[string]string)
+	for results.Next() {
+		var name, dataType string
+		if err := results.Scan(&name, &dataType); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(name)] = strings.ToLower(dataType)
+	}
+	return columns, results.Err()
+}
+
+func handleSchemaCheck(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		columns, err := getTableColumns(booksTable)
+		if err != nil {
+			writeDBError(w, r, err, "could not read table schema")
+			return
+		}
+		if len(columns) == 0 {
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("table %s not found", booksTable))
+			return
+		}
+		mismatches := compareSchema(expectedBookSchema, columns)
+		writeJSON(w, r, http.StatusOK, schemaReport{Table: booksTable, OK: len(mismatches) == 0, Mismatches: mismatches})
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func schemaRows(skip string, retype map[string]string) fakeResult {
+	result := fakeResult{columns: []string{"column_name", "data_type"}}
+	for _, column := range expectedBookSchema {
+		if column.Name == skip {
+			continue
+		}
+		dataType := column.Type
+		if override, ok := retype[column.Name]; ok {
+			dataType = override
+		}
+		result.rows = append(result.rows, []driver.Value{column.Name, dataType})
+	}
+	return result
+}
+
+func TestSchemaCheckReportsMissingColumn(t *testing.T) {
+	setForTest(t, &debugEndpoints, true)
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return schemaRows("isbn", map[string]string{"stock": "varchar"})
+	})
+	w := serve(debugMiddleware(http.HandlerFunc(handleSchemaCheck)), http.MethodGet, "/api/debug/schema-check", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var report schemaReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	want := []schemaMismatch{
+		{Column: "stock", Expected: "int", Actual: "varchar", Problem: "type mismatch"},
+		{Column: "isbn", Expected: "varchar", Problem: "missing"},
+	}
+	if report.OK || len(report.Mismatches) != len(want) {
+		t.Fatalf("report = %+v", report)
+	}
+	for i := range want {
+		if report.Mismatches[i] != want[i] {
+			t.Errorf("mismatch %d = %+v, want %+v", i, report.Mismatches[i], want[i])
+		}
+	}
+	if query, _ := fake.find("information_schema.columns"); len(query.args) != 1 || query.args[0] != "books" {
+		t.Errorf("args = %v", query.args)
+	}
+}
+
+func TestSchemaCheckMatchingSchemaIsOK(t *testing.T) {
+	setForTest(t, &debugEndpoints, true)
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return schemaRows("", nil)
+	})
+	w := serve(debugMiddleware(http.HandlerFunc(handleSchemaCheck)), http.MethodGet, "/api/debug/schema-check", "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != `{"table":"books","ok":true,"mismatches":[]}`+"\n" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
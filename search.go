@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type searchResult struct {
+	Book  Book `json:"book"`
+	Score int  `json:"score"`
+}
+
+type searchHit struct {
+	Book  interface{} `json:"book"`
+	Score int         `json:"score"`
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func searchBooks(term string) ([]searchResult, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	pattern := "%" + likeEscaper.Replace(term) + "%"
+	query := fmt.Sprintf(`SELECT %s, score FROM (
+		SELECT %s,
+			(bookname LIKE ?) * 8 + (author LIKE ?) * 4 + COALESCE(genre LIKE ?, 0) * 2 + COALESCE(publisher LIKE ?, 0) AS score
+		FROM %s WHERE deleted_at IS NULL AND status = ?
+	) AS scored WHERE score > 0 ORDER BY score DESC, bookid`, bookColumns, bookColumns, booksTable)
+	results, err := readQueryContext(ctx, query, pattern, pattern, pattern, pattern, statusPublished)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	matches := make([]searchResult, 0)
+	for results.Next() {
+		var match searchResult
+		err := results.Scan(append(bookScanDest(&match.Book), &match.Score)...)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	if err := results.Err(); err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	return matches, nil
+}
+
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		term := strings.TrimSpace(r.URL.Query().Get("q"))
+		if term == "" {
+			writeError(w, r, http.StatusBadRequest, "q is required")
+			return
+		}
+		if err := checkFilterLength("q", term); err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		matches, err := searchBooks(term)
+		if err != nil {
+			writeDBError(w, r, err, "could not search books")
+			return
+		}
+		hits := make([]searchHit, 0, len(matches))
+		for i := range matches {
+			hits = append(hits, searchHit{Book: visibleBook(r, &matches[i].Book), Score: matches[i].Score})
+		}
+		writeJSON(w, r, http.StatusOK, hits)
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var scoreTerm = regexp.MustCompile(`(COALESCE)?\((\w+) LIKE \?(?:, 0)?\)(?: \* (\d+))?`)
+
+// scoreBooks evaluates the weighted LIKE expression of the search query
+// against books, so the test exercises the weights the SQL really uses.
+// Columns named in nullColumns are NULL in every row, and an unguarded LIKE
+// on them makes the score NULL just as it does in MySQL.
+func scoreBooks(query, term string, books []Book, nullColumns ...string) fakeResult {
+	columnNames := strings.Split(bookColumns, ", ")
+	result := fakeResult{columns: append(columnNames, "score")}
+	type scored struct {
+		book  Book
+		score int
+	}
+	isNull := make(map[string]bool)
+	for _, column := range nullColumns {
+		isNull[column] = true
+	}
+	var hits []scored
+	for _, book := range books {
+		columns := map[string]string{"bookname": book.BookName, "author": book.Author, "genre": book.Genre, "publisher": book.Publisher}
+		score, null := 0, false
+		for _, match := range scoreTerm.FindAllStringSubmatch(query, -1) {
+			if isNull[match[2]] {
+				null = null || match[1] == ""
+				continue
+			}
+			weight := 1
+			if match[3] != "" {
+				weight, _ = strconv.Atoi(match[3])
+			}
+			if strings.Contains(strings.ToLower(columns[match[2]]), strings.ToLower(term)) {
+				score += weight
+			}
+		}
+		if score > 0 && !null {
+			hits = append(hits, scored{book, score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	for _, hit := range hits {
+		row := bookRow(hit.book)
+		for i, name := range columnNames {
+			if isNull[name] {
+				row[i] = nil
+			}
+		}
+		result.rows = append(result.rows, append(row, int64(hit.score)))
+	}
+	return result
+}
+
+func TestSearchRanksNameAbovePublisher(t *testing.T) {
+	byPublisher := testBook(1, "Networking Basics")
+	byPublisher.Publisher = "Gopher Press"
+	byName := testBook(2, "Learning Gopher Patterns")
+	byName.Publisher = "O'Reilly"
+	unrelated := testBook(3, "Emma")
+	unrelated.Publisher = "Penguin"
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return scoreBooks(query, "gopher", []Book{byPublisher, byName, unrelated})
+	})
+	w := serve(http.HandlerFunc(handleSearch), http.MethodGet, "/api/search?q=gopher", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var hits []searchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &hits); err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 || hits[0].Book.BookID != 2 || hits[1].Book.BookID != 1 {
+		t.Fatalf("hits = %+v", hits)
+	}
+	if hits[0].Score <= hits[1].Score {
+		t.Errorf("scores = %d, %d", hits[0].Score, hits[1].Score)
+	}
+	search, _ := fake.find("score")
+	if search.args[0] != "%gopher%" || search.args[4] != statusPublished {
+		t.Errorf("args = %v", search.args)
+	}
+}
+
+func TestSearchScoresRowsWithNullGenre(t *testing.T) {
+	book := testBook(1, "Dune")
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return scoreBooks(query, "dune", []Book{book}, "genre")
+	})
+	w := serve(http.HandlerFunc(handleSearch), http.MethodGet, "/api/search?q=dune", "", nil)
+	var hits []searchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &hits); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if len(hits) != 1 || hits[0].Book.BookID != 1 || hits[0].Score != 8 || hits[0].Book.Genre != "" {
+		t.Fatalf("hits = %+v", hits)
+	}
+}
+
+func TestSearchEscapesLikeWildcards(t *testing.T) {
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return scoreBooks(query, "", nil)
+	})
+	serve(http.HandlerFunc(handleSearch), http.MethodGet, "/api/search?q=100%25_off", "", nil)
+	search, _ := fake.find("score")
+	if search.args[0] != `%100\%\_off%` {
+		t.Errorf("pattern = %v", search.args[0])
+	}
+}
+
+func TestSearchRequiresTerm(t *testing.T) {
+	w := serve(http.HandlerFunc(handleSearch), http.MethodGet, "/api/search?q=+", "", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
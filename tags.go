@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	tagModeAll = "all"
+	tagModeAny = "any"
+)
+
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+func normalizeTags(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	tags := make([]string, 0, len(values))
+	for _, value := range values {
+		tag := strings.ToLower(strings.TrimSpace(value))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func parseTagFilter(value, mode string) ([]string, string, error) {
+	tags := normalizeTags(strings.Split(value, ","))
+	for _, tag := range tags {
+		if err := checkFilterLength("tags", tag); err != nil {
+			return nil, "", err
+		}
+	}
+	switch mode {
+	case "":
+		mode = tagModeAll
+	case tagModeAll, tagModeAny:
+	default:
+		return nil, "", fmt.Errorf("tag_mode must be %s or %s", tagModeAll, tagModeAny)
+	}
+	return tags, mode, nil
+}
+
+func tagCondition(tags []string, mode string) (string, []interface{}) {
+	condition := fmt.Sprintf("bookid IN (SELECT bt.bookid FROM %[1]s_book_tags bt JOIN %[1]s_tags t ON t.id = bt.tag_id WHERE %[2]s", booksTable, inCondition("t.name", "?", len(tags)))
+	if mode == tagModeAll {
+		condition += fmt.Sprintf(" GROUP BY bt.bookid HAVING COUNT(DISTINCT t.id) = %d", len(tags))
+	}
+	return condition + ")", stringArgs(tags)
+}
+
+func getBookTags(bookID int) ([]string, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	results, err := readQueryContext(ctx, fmt.Sprintf(`SELECT t.name FROM %[1]s_book_tags bt JOIN %[1]s_tags t ON t.id = bt.tag_id WHERE bt.bookid = ? ORDER BY t.name`, booksTable), bookID)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	defer results.Close()
+	tags := make([]string, 0)
+	for results.Next() {
+		var tag string
+		if err := results.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, results.Err()
+}
+
+func attachBookTags(bookID int, tags []string) (bool, error) {
+	ctx, cancel, err := dbContext()
+	if err != nil {
+		return false, err
+	}
+	defer cancel()
+	found := false
+	err = retryWrites(ctx, func() error {
+		tx, err := beginTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer rollbackTx(tx)
+		book, err := getBookTx(ctx, tx, bookID)
+		if found = book != nil; err != nil || !found {
+			return err
+		}
+		for _, tag := range tags {
+			if _, err := txExecContext(ctx, tx, fmt.Sprintf(`INSERT IGNORE INTO %s_tags (name) VALUES (?)`, booksTable), tag); err != nil {
+				return err
+			}
+			if _, err := txExecContext(ctx, tx, fmt.Sprintf(`INSERT IGNORE INTO %[1]s_book_tags (bookid, tag_id) SELECT ?, id FROM %[1]s_tags WHERE name = ?`, booksTable), bookID, tag); err != nil {
+				return err
+			}
+		}
+		return commitTx(tx)
+	})
+	if err != nil {
+		log.Println(err.Error())
+		return false, err
+	}
+	return found, nil
+}
+
+func handleBookTags(w http.ResponseWriter, r *http.Request, bookID int) {
+	switch r.Method {
+	case http.MethodGet:
+		tags, err := getBookTags(bookID)
+		if err != nil {
+			writeDBError(w, r, err, "could not get book tags")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, tagsRequest{Tags: tags})
+	case http.MethodPost:
+		var request tagsRequest
+		if err := decodeJSON(r.Body, &request); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid tags payload: "+err.Error())
+			return
+		}
+		tags := normalizeTags(request.Tags)
+		if len(tags) == 0 {
+			writeError(w, r, validationStatus(), "at least one tag is required")
+			return
+		}
+		for _, tag := range tags {
+			if len(tag) > 64 {
+				writeError(w, r, validationStatus(), fmt.Sprintf("tag %q exceeds 64 characters", tag))
+				return
+			}
+		}
+		found, err := attachBookTags(bookID, tags)
+		if err != nil {
+			writeDBError(w, r, err, "could not tag book")
+			return
+		}
+		if !found {
+			writeError(w, r, http.StatusNotFound, "book not found")
+			return
+		}
+		tags, err = getBookTags(bookID)
+		if err != nil {
+			writeDBError(w, r, err, "could not get book tags")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, tagsRequest{Tags: tags})
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// taggedBooksDB answers the tag subquery from bookTags: with HAVING a book
+// must carry every requested tag, without it any one will do.
+func taggedBooksDB(t *testing.T, bookTags map[int][]string) *fakeDB {
+	return useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		requested := args[1:]
+		var rows []Book
+		for id := 1; id <= len(bookTags); id++ {
+			matched := 0
+			for _, tag := range bookTags[id] {
+				for _, want := range requested {
+					if tag == want {
+						matched++
+					}
+				}
+			}
+			if matched > 0 && (!strings.Contains(query, "HAVING COUNT(DISTINCT t.id)") || matched == len(requested)) {
+				rows = append(rows, testBook(id, "Book"))
+			}
+		}
+		return bookRows(rows...)
+	})
+}
+
+func listedIDs(t *testing.T, target string) []int {
+	t.Helper()
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, target, "", nil)
+	var books []Book
+	if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("%s: got %d %s", target, w.Code, w.Body.String())
+	}
+	return bookIDs(books)
+}
+
+func TestTagsMatchAllByDefault(t *testing.T) {
+	fake := taggedBooksDB(t, map[int][]string{1: {"classic", "signed"}, 2: {"classic"}, 3: {"signed"}})
+	if got := listedIDs(t, "/api/books?tags=Classic,signed"); len(got) != 1 || got[0] != 1 {
+		t.Errorf("ids = %v, want only the book with both tags", got)
+	}
+	list, _ := fake.find("SELECT")
+	if !strings.Contains(list.query, "t.name IN (?,?) GROUP BY bt.bookid HAVING COUNT(DISTINCT t.id) = 2") {
+		t.Errorf("query = %q", list.query)
+	}
+}
+
+func TestTagsMatchAny(t *testing.T) {
+	taggedBooksDB(t, map[int][]string{1: {"classic", "signed"}, 2: {"classic"}, 3: {"signed"}, 4: {"rare"}})
+	if got := listedIDs(t, "/api/books?tags=classic,signed&tag_mode=any"); len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("ids = %v, want every book with either tag", got)
+	}
+	w := serve(http.HandlerFunc(handleBooks), http.MethodGet, "/api/books?tags=classic&tag_mode=some", "", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad tag_mode: status = %d", w.Code)
+	}
+}
+
+func TestAttachTags(t *testing.T) {
+	fake := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "SELECT t.name") {
+			return fakeResult{columns: []string{"name"}, rows: [][]driver.Value{{"classic"}, {"signed"}}}
+		}
+		return bookStore(map[int]Book{1: testBook(1, "Dune")}, 0)(query, args)
+	})
+	w := serve(http.HandlerFunc(handleBook), http.MethodPost, "/api/books/1/tags", `{"tags":["Signed"," classic ","signed"]}`, nil)
+	if w.Code != http.StatusOK || w.Body.String() != `{"tags":["classic","signed"]}`+"\n" {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	var attached []driver.Value
+	for _, statement := range fake.statements {
+		if strings.HasPrefix(statement.query, "INSERT IGNORE INTO books_tags") {
+			attached = append(attached, statement.args[0])
+		}
+	}
+	if len(attached) != 2 || attached[0] != "signed" || attached[1] != "classic" || fake.commits != 1 {
+		t.Errorf("attached = %v, commits = %d", attached, fake.commits)
+	}
+}
+
+func TestTagTablesFollowBooksTable(t *testing.T) {
+	setForTest(t, &booksTable, "tenant_books")
+	if condition, _ := tagCondition([]string{"classic"}, tagModeAll); !strings.Contains(condition, "FROM tenant_books_book_tags bt JOIN tenant_books_tags t ") {
+		t.Errorf("condition = %q", condition)
+	}
+	for _, i := range []int{11, 12} {
+		if statement := migrationSQL(migrations[i]); !strings.Contains(statement, "CREATE TABLE IF NOT EXISTS tenant_books_") {
+			t.Errorf("migration %d = %q", i+1, statement)
+		}
+	}
+}
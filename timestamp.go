@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	timeFormatRFC3339    = "rfc3339"
+	timeFormatUnix       = "unix"
+	timeFormatUnixMillis = "unix_ms"
+)
+
+var timeFormat = parseTimeFormat(getEnv("TIME_FORMAT", timeFormatRFC3339))
+
+func parseTimeFormat(value string) string {
+	switch value {
+	case timeFormatRFC3339, timeFormatUnix, timeFormatUnixMillis:
+		return value
+	}
+	log.Printf("invalid TIME_FORMAT %q, using %s", value, timeFormatRFC3339)
+	return timeFormatRFC3339
+}
+
+type Timestamp struct {
+	time.Time
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	switch timeFormat {
+	case timeFormatUnix:
+		return strconv.AppendInt(nil, t.Unix(), 10), nil
+	case timeFormatUnixMillis:
+		return strconv.AppendInt(nil, t.UnixMilli(), 10), nil
+	}
+	return t.Time.MarshalJSON()
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return t.Time.UnmarshalJSON(data)
+	}
+	n, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %s", data)
+	}
+	if timeFormat == timeFormatUnixMillis {
+		t.Time = time.UnixMilli(n).UTC()
+	} else {
+		t.Time = time.Unix(n, 0).UTC()
+	}
+	return nil
+}
+
+func (t *Timestamp) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		t.Time = v
+	case nil:
+		t.Time = time.Time{}
+	default:
+		return fmt.Errorf("cannot scan %T into Timestamp", value)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTimestampFormats(t *testing.T) {
+	stamp := Timestamp{testTime}
+	for format, want := range map[string]string{
+		timeFormatRFC3339:    `"2024-03-01T12:00:00Z"`,
+		timeFormatUnix:       `1709294400`,
+		timeFormatUnixMillis: `1709294400000`,
+	} {
+		setForTest(t, &timeFormat, format)
+		got, err := json.Marshal(stamp)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %s (%v), want %s", format, got, err, want)
+			continue
+		}
+		var back Timestamp
+		if err := json.Unmarshal(got, &back); err != nil || !back.Equal(testTime) {
+			t.Errorf("%s: round trip = %v (%v)", format, back, err)
+		}
+	}
+}
+
+func TestParseTimeFormatFallsBackToRFC3339(t *testing.T) {
+	captureLog(t)
+	if got := parseTimeFormat("iso"); got != timeFormatRFC3339 {
+		t.Errorf("parseTimeFormat = %q", got)
+	}
+}
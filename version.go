@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const schemaVersionContextKey contextKey = "schema-version"
+
+const currentSchemaVersion = "1"
+
+var supportedSchemaVersions = []string{currentSchemaVersion}
+
+func negotiateSchemaVersion(requested string) (string, bool) {
+	requested = strings.TrimPrefix(strings.TrimSpace(requested), "v")
+	if requested == "" {
+		return currentSchemaVersion, true
+	}
+	for _, version := range supportedSchemaVersions {
+		if version == requested {
+			return version, true
+		}
+	}
+	return "", false
+}
+
+func schemaVersionFromContext(ctx context.Context) string {
+	if version, ok := ctx.Value(schemaVersionContextKey).(string); ok {
+		return version
+	}
+	return currentSchemaVersion
+}
+
+func schemaVersionMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, ok := negotiateSchemaVersion(r.Header.Get("Accept-Version"))
+		if !ok {
+			w.Header().Set("X-API-Schema-Version", currentSchemaVersion)
+			writeError(w, r, http.StatusNotAcceptable, fmt.Sprintf("unsupported schema version, supported: %s", strings.Join(supportedSchemaVersions, ", ")))
+			return
+		}
+		w.Header().Set("X-API-Schema-Version", version)
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), schemaVersionContextKey, version)))
+	})
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBookResponsesCarrySchemaVersion(t *testing.T) {
+	useFakeDB(t, bookStore(map[int]Book{1: testBook(1, "Dune")}, 0))
+	w := serve(bookRoute(handleBook), http.MethodGet, "/api/books/1", "", nil)
+	if w.Code != http.StatusOK || w.Header().Get("X-API-Schema-Version") != currentSchemaVersion {
+		t.Fatalf("got %d, version %q", w.Code, w.Header().Get("X-API-Schema-Version"))
+	}
+}
+
+func TestAcceptVersionNegotiation(t *testing.T) {
+	var seen string
+	handler := schemaVersionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = schemaVersionFromContext(r.Context())
+	}))
+	w := serve(handler, http.MethodGet, "/api/books", "", map[string]string{"Accept-Version": "v1"})
+	if w.Code != http.StatusOK || seen != "1" || w.Header().Get("X-API-Schema-Version") != "1" {
+		t.Errorf("v1: got %d, handler saw %q", w.Code, seen)
+	}
+	seen = ""
+	w = serve(handler, http.MethodGet, "/api/books", "", map[string]string{"Accept-Version": "7"})
+	if w.Code != http.StatusNotAcceptable || seen != "" {
+		t.Errorf("unsupported version: got %d, handler saw %q", w.Code, seen)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queuedPending  = "pending"
+	queuedInserted = "inserted"
+	queuedFailed   = "failed"
+)
+
+var (
+	writeQueueEnabled   = getEnvBool("WRITE_QUEUE", false)
+	writeQueueInterval  = getEnvDuration("WRITE_QUEUE_FLUSH_INTERVAL", 50*time.Millisecond)
+	writeQueueBatchSize = getEnvInt("WRITE_QUEUE_BATCH_SIZE", 100)
+	writeQueueCapacity  = getEnvInt("WRITE_QUEUE_CAPACITY", 10000)
+	writeQueueRetention = getEnvDuration("WRITE_QUEUE_RETENTION", 10*time.Minute)
+)
+
+var (
+	errWriteQueueFull   = errors.New("write queue is full")
+	errWriteQueueClosed = errors.New("write queue is closed")
+)
+
+type queuedWrite struct {
+	ID     string `json:"tracking_id"`
+	Status string `json:"status"`
+	BookID int    `json:"bookid,omitempty"`
+	Error  string `json:"error,omitempty"`
+	book   Book
+	actor  string
+}
+
+type writeQueue struct {
+	mu       sync.Mutex
+	writes   chan *queuedWrite
+	tracked  map[string]*queuedWrite
+	insert   func(books []Book, actor string) ([]int, error)
+	draining bool
+	done     chan struct{}
+}
+
+func newWriteQueue(capacity int) *writeQueue {
+	return &writeQueue{
+		writes:  make(chan *queuedWrite, capacity),
+		tracked: make(map[string]*queuedWrite),
+		insert:  insertBooks,
+		done:    make(chan struct{}),
+	}
+}
+
+var bookWriteQueue = newWriteQueue(writeQueueCapacity)
+
+func newTrackingID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Print(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (q *writeQueue) enqueue(book Book, actor string) (queuedWrite, error) {
+	write := &queuedWrite{ID: newTrackingID(), Status: queuedPending, book: book, actor: actor}
+	accepted := *write
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.draining {
+		return queuedWrite{}, errWriteQueueClosed
+	}
+	select {
+	case q.writes <- write:
+		q.tracked[write.ID] = write
+		return accepted, nil
+	default:
+		return queuedWrite{}, errWriteQueueFull
+	}
+}
+
+func (q *writeQueue) lookup(id string) (queuedWrite, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	write, ok := q.tracked[id]
+	if !ok {
+		return queuedWrite{}, false
+	}
+	return *write, true
+}
+
+func (q *writeQueue) finish(write *queuedWrite, bookID int, err error) {
+	q.mu.Lock()
+	if err != nil {
+		write.Status, write.Error = queuedFailed, err.Error()
+	} else {
+		write.Status, write.BookID = queuedInserted, bookID
+	}
+	q.mu.Unlock()
+	time.AfterFunc(writeQueueRetention, func() {
+		q.mu.Lock()
+		delete(q.tracked, write.ID)
+		q.mu.Unlock()
+	})
+}
+
+func (q *writeQueue) flush(batch []*queuedWrite) {
+	byActor := make(map[string][]*queuedWrite)
+	var actors []string
+	for _, write := range batch {
+		if _, ok := byActor[write.actor]; !ok {
+			actors = append(actors, write.actor)
+		}
+		byActor[write.actor] = append(byActor[write.actor], write)
+	}
+	for _, actor := range actors {
+		writes := byActor[actor]
+		books := make([]Book, len(writes))
+		for i, write := range writes {
+			books[i] = write.book
+		}
+		ids, err := q.insert(books, actor)
+		if err == nil {
+			for i, write := range writes {
+				q.finish(write, ids[i], nil)
+			}
+			continue
+		}
+		for _, write := range writes {
+			ids, err := q.insert([]Book{write.book}, actor)
+			if err != nil {
+				q.finish(write, 0, err)
+				continue
+			}
+			q.finish(write, ids[0], nil)
+		}
+	}
+}
+
+func (q *writeQueue) run(ctx context.Context, interval time.Duration, batchSize int) {
+	defer close(q.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	batch := make([]*queuedWrite, 0, batchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			q.flush(batch)
+			batch = make([]*queuedWrite, 0, batchSize)
+		}
+	}
+	for {
+		select {
+		case write := <-q.writes:
+			batch = append(batch, write)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.draining = true
+			q.mu.Unlock()
+			for {
+				select {
+				case write := <-q.writes:
+					batch = append(batch, write)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func handleQueuedWrite(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		segments := strings.SplitN(r.URL.Path, bookPath+"/queued/", 2)
+		write, ok := bookWriteQueue.lookup(segments[len(segments)-1])
+		if len(segments) != 2 || !ok {
+			writeError(w, r, http.StatusNotFound, "queued write not found")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, write)
+	case http.MethodOptions:
+		return
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func queueBooks(t *testing.T, names ...string) []queuedWrite {
+	t.Helper()
+	var accepted []queuedWrite
+	for _, name := range names {
+		w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"`+name+`","author":"Frank Herbert"}`, nil)
+		var write queuedWrite
+		if err := json.Unmarshal(w.Body.Bytes(), &write); err != nil || w.Code != http.StatusAccepted {
+			t.Fatalf("%s: got %d %s", name, w.Code, w.Body.String())
+		}
+		if w.Header().Get("Location") != "/api/books/queued/"+write.ID || write.Status != queuedPending {
+			t.Fatalf("%s: accepted = %+v, Location %q", name, write, w.Header().Get("Location"))
+		}
+		accepted = append(accepted, write)
+	}
+	return accepted
+}
+
+func drainQueue(q *writeQueue) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.run(ctx, time.Hour, 100)
+}
+
+func queuedStatus(t *testing.T, id string) queuedWrite {
+	t.Helper()
+	w := serve(http.HandlerFunc(handleQueuedWrite), http.MethodGet, "/api/books/queued/"+id, "", nil)
+	var write queuedWrite
+	if err := json.Unmarshal(w.Body.Bytes(), &write); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	return write
+}
+
+func TestWriteQueueFlushesOneMultiRowInsert(t *testing.T) {
+	setForTest(t, &writeQueueEnabled, true)
+	setForTest(t, &uniqueTitles, true)
+	setForTest(t, &bookWriteQueue, newWriteQueue(10))
+	store := &insertStore{nextID: 100}
+	useFakeDB(t, store.handle)
+	accepted := queueBooks(t, "Dune", "Dune Messiah", "Children of Dune")
+	if len(store.books) != 0 {
+		t.Fatalf("inserted before the flush: %+v", store.books)
+	}
+	drainQueue(bookWriteQueue)
+	if store.inserts != 1 || len(store.books) != 3 {
+		t.Fatalf("inserts = %d, books = %d, want one statement for the batch", store.inserts, len(store.books))
+	}
+	for i, write := range accepted {
+		if got := queuedStatus(t, write.ID); got.Status != queuedInserted || got.BookID != 101+i {
+			t.Errorf("write %d = %+v", i, got)
+		}
+	}
+}
+
+func TestWriteQueueFallsBackPerRow(t *testing.T) {
+	setForTest(t, &writeQueueEnabled, true)
+	setForTest(t, &uniqueTitles, true)
+	setForTest(t, &bookWriteQueue, newWriteQueue(10))
+	store := &insertStore{fail: func(book Book) error {
+		if book.BookName == "Bad" {
+			return errors.New("data too long")
+		}
+		return nil
+	}}
+	useFakeDB(t, store.handle)
+	accepted := queueBooks(t, "Dune", "Bad", "Emma")
+	drainQueue(bookWriteQueue)
+	statuses := []string{queuedStatus(t, accepted[0].ID).Status, queuedStatus(t, accepted[1].ID).Status, queuedStatus(t, accepted[2].ID).Status}
+	if statuses[0] != queuedInserted || statuses[1] != queuedFailed || statuses[2] != queuedInserted {
+		t.Errorf("statuses = %v", statuses)
+	}
+	if len(store.books) != 2 {
+		t.Errorf("books = %+v", store.books)
+	}
+}
+
+func TestFullWriteQueueIs503(t *testing.T) {
+	setForTest(t, &writeQueueEnabled, true)
+	setForTest(t, &bookWriteQueue, newWriteQueue(1))
+	queueBooks(t, "Dune")
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Emma","author":"Jane Austen"}`, nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestDrainingWriteQueueRejectsWrites(t *testing.T) {
+	setForTest(t, &writeQueueEnabled, true)
+	setForTest(t, &bookWriteQueue, newWriteQueue(10))
+	store := &insertStore{nextID: 100}
+	useFakeDB(t, store.handle)
+	queueBooks(t, "Dune")
+	drainQueue(bookWriteQueue)
+	if _, err := bookWriteQueue.enqueue(Book{BookName: "Emma"}, ""); !errors.Is(err, errWriteQueueClosed) {
+		t.Fatalf("enqueue after drain: err = %v", err)
+	}
+	w := serve(http.HandlerFunc(handleBooks), http.MethodPost, "/api/books", `{"bookname":"Emma","author":"Jane Austen"}`, nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if len(store.books) != 1 {
+		t.Errorf("books = %+v, want only the write accepted before the drain", store.books)
+	}
+}